@@ -27,16 +27,23 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 }
 
 func addDefaultingFuncs(scheme *runtime.Scheme) error {
-	return scheme.AddDefaultingFuncs(
-		func(obj *MemHpa) {
-			if obj.Spec.MinReplicas == nil {
-				minReplicas := int32(1)
-				obj.Spec.MinReplicas = &minReplicas
-			}
-			if obj.Spec.TargetUtilizationPercentage == nil {
-				percentage := int32(80)
-				obj.Spec.TargetUtilizationPercentage = &percentage
-			}
-		},
-	)
+	return scheme.AddDefaultingFuncs(SetDefaults)
+}
+
+// Set defaults of the unset fields of spec
+func SetDefaults(obj *MemHpa) {
+	if obj.Spec.MinReplicas == nil {
+		minReplicas := int32(1)
+		obj.Spec.MinReplicas = &minReplicas
+	}
+	if obj.Spec.TargetUtilizationPercentage == nil && obj.Spec.TargetAverageValue == nil {
+		percentage := int32(80)
+		obj.Spec.TargetUtilizationPercentage = &percentage
+	}
+	if obj.Spec.UtilizationBase == "" {
+		obj.Spec.UtilizationBase = UtilizationBaseLimits
+	}
+	if obj.Spec.Mode == "" {
+		obj.Spec.Mode = AutoScalingMode
+	}
 }
\ No newline at end of file
@@ -1,10 +1,16 @@
 package v1
 
 import (
+	"fmt"
+	"time"
+
+	"memhpa/cron"
+
 	"k8s.io/client-go/1.4/pkg/api/v1"
 	autoscaling "k8s.io/client-go/1.4/pkg/apis/autoscaling/v1"
 	"k8s.io/client-go/1.4/pkg/api/unversioned"
 	"k8s.io/client-go/1.4/pkg/api/meta"
+	"k8s.io/client-go/1.4/pkg/api/resource"
 	"encoding/json"
 )
 
@@ -12,9 +18,235 @@ const (
 	MemHPAResourcesGroup = "xinhuang.com"
 	MemHPAResourcesName = "memhpas"
 	MemHPAResourcesVersion = "v1"
+	MemHPAResourcesKind = "MemHpa"
+	MemHPAResourcesSingularName = "memhpa"
+	MemHPAResourcesShortName = "mhpa"
+	// Name of the CustomResourceDefinition
+	MemHPAResourcesCRDName = MemHPAResourcesName + "." + MemHPAResourcesGroup
+	// Name of the legacy ThirdPartyResource
 	MemHPAResourcesMetaName = "mem-hpa.xinhuang.com"
+	// Finalizer of MemHpa with replicasOnDelete, the target is scaled to replicasOnDelete before it is removed
+	RestoreReplicasFinalizer = MemHPAResourcesGroup + "/restore-replicas"
+)
+
+// Memory signal by which utilization is calculated
+type MemorySignal string
+
+const (
+	// Total memory usage including page cache (container_memory_usage_bytes)
+	MemorySignalUsage MemorySignal = "usage"
+	// Usage excluding inactive page cache (container_memory_working_set_bytes)
+	MemorySignalWorkingSet MemorySignal = "workingSet"
+	// Anonymous and swap cache memory (container_memory_rss)
+	MemorySignalRSS MemorySignal = "rss"
+	// Usage excluding all page cache (container_memory_usage_bytes - container_memory_cache)
+	MemorySignalUsageWithoutCache MemorySignal = "usageWithoutCache"
+)
+
+// Resource of containers relative to which utilization is calculated
+type UtilizationBase string
+
+const (
+	UtilizationBaseLimits UtilizationBase = "limits"
+	UtilizationBaseRequests UtilizationBase = "requests"
+	// Use the limit of a container, or its request if the limit is not set
+	UtilizationBaseLimitsOrRequests UtilizationBase = "limitsOrRequests"
+)
+
+// Type of metric to scale on
+type MetricSourceType string
+
+const (
+	// Memory of pods, configured by the memory fields of MemHPASpec
+	MemoryMetricSourceType MetricSourceType = "Memory"
+	// CPU usage of pods
+	CPUMetricSourceType MetricSourceType = "CPU"
+	// Value of each pod returned by a Prometheus query
+	PrometheusMetricSourceType MetricSourceType = "Prometheus"
+)
+
+// Metric to scale on
+type MetricSpec struct {
+	Type MetricSourceType `json:"type"`
+	// Target utilization percentage of limits or requests, only for Memory and CPU
+	TargetUtilizationPercentage *int32 `json:"targetUtilizationPercentage,omitempty"`
+	// Target average value per pod. It takes precedence over TargetUtilizationPercentage and is required by Prometheus.
+	TargetAverageValue *resource.Quantity `json:"targetAverageValue,omitempty"`
+	// Go template of PromQL returning a value per pod, required by Prometheus.
+	// For Memory it overrides .spec.metricQuery, for CPU the default template of the backend.
+	Query string `json:"query,omitempty"`
+}
+
+type MetricStatus struct {
+	Type MetricSourceType `json:"type"`
+	CurrentUtilizationPercentage *int32 `json:"currentUtilizationPercentage,omitempty"`
+	CurrentAverageValue *resource.Quantity `json:"currentAverageValue,omitempty"`
+	// Forecast by .spec.prediction which replicas were sized for, only set for Memory
+	PredictedUtilizationPercentage *int32 `json:"predictedUtilizationPercentage,omitempty"`
+	PredictedAverageValue *resource.Quantity `json:"predictedAverageValue,omitempty"`
+}
+
+// Type of a scaling policy
+type ScalingPolicyType string
+
+const (
+	// Limit the change of replicas to a number of pods
+	PodsScalingPolicy ScalingPolicyType = "Pods"
+	// Limit the change of replicas to a percentage of the replicas at the start of the period
+	PercentScalingPolicy ScalingPolicyType = "Percent"
+)
+
+// How to choose among the policies of a direction
+type ScalingPolicySelect string
+
+const (
+	// Select the policy allowing the largest change
+	MaxPolicySelect ScalingPolicySelect = "Max"
+	// Select the policy allowing the smallest change
+	MinPolicySelect ScalingPolicySelect = "Min"
+	// Disable scaling in the direction
+	DisabledPolicySelect ScalingPolicySelect = "Disabled"
+)
+
+// Defaults of behavior, the same as the fixed windows and scale up limit max(2 * current, 4) of earlier versions
+const (
+	DefaultScaleUpStabilizationWindowSeconds = 180
+	DefaultScaleDownStabilizationWindowSeconds = 300
+	// Min replicas allowed by the default scale up policy, however few the current replicas are
+	DefaultScaleUpLimitMinimum = 4
+	DefaultScalingPolicyPeriodSeconds = 60
+
+	// Bounds of behavior, the same as K8S HorizontalPodAutoscaler
+	MaxStabilizationWindowSeconds = 3600
+	MaxScalingPolicyPeriodSeconds = 1800
+)
+
+// Limit of the change of replicas in a period
+type HPAScalingPolicy struct {
+	Type ScalingPolicyType `json:"type"`
+	// Number of pods or percentage according to Type, must be positive
+	Value int32 `json:"value"`
+	// Length of the period, changes of replicas in the past period are counted against Value
+	PeriodSeconds int32 `json:"periodSeconds"`
+}
+
+// Scaling rules of a direction
+type HPAScalingRules struct {
+	// For scaling up, no scaling up happens within the window since the last scale.
+	// For scaling down, replicas are scaled down to the max recommendation within the window.
+	StabilizationWindowSeconds *int32 `json:"stabilizationWindowSeconds,omitempty"`
+	// Max, Min or Disabled, default Max
+	SelectPolicy ScalingPolicySelect `json:"selectPolicy,omitempty"`
+	Policies []HPAScalingPolicy `json:"policies,omitempty"`
+}
+
+// Scaling behavior of each direction, defaults are used for the unset fields
+type MemHPAScalingBehavior struct {
+	ScaleUp *HPAScalingRules `json:"scaleUp,omitempty"`
+	ScaleDown *HPAScalingRules `json:"scaleDown,omitempty"`
+}
+
+// Override of min and max replicas in a recurring period, e.g. business hours
+type ScheduleSpec struct {
+	// Unique name reported in status
+	Name string `json:"name"`
+	// Cron expression of starts of the period, e.g. "0 8 * * MON-FRI"
+	Schedule string `json:"schedule"`
+	// IANA time zone of the cron expression, e.g. Asia/Shanghai, default UTC
+	TimeZone string `json:"timeZone,omitempty"`
+	// Length of the period since each start, e.g. 10h
+	Duration string `json:"duration"`
+	// Overrides of .spec.minReplicas and .spec.maxReplicas, the unset ones are not overridden
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+}
+
+// Scale the target to zero while it is idle, and wake it up on demand
+type ScaleToZeroSpec struct {
+	// The target is idle while memory of all its ready pods in total is below this value, e.g. 64Mi
+	IdleBelow resource.Quantity `json:"idleBelow"`
+	// How long the target must be idle before it is scaled to zero, e.g. 30m
+	IdleDuration string `json:"idleDuration"`
+	// PromQL returning a scalar or a single series, e.g. the rate of requests queued for the target.
+	// The target is woken up, and not scaled to zero, while the value is positive.
+	WakeQuery string `json:"wakeQuery"`
+	// Replicas the target is woken up to, default 1
+	WakeReplicas *int32 `json:"wakeReplicas,omitempty"`
+}
+
+// Method to forecast memory from its history
+type PredictionMethod string
+
+const (
+	// Least squares line fitted to the history
+	LinearPredictionMethod PredictionMethod = "Linear"
+	// Holt's double exponential smoothing, which follows recent changes of the trend faster
+	HoltPredictionMethod PredictionMethod = "Holt"
+)
+
+// Defaults of prediction
+const (
+	DefaultPredictionWindow = "30m"
+	DefaultPredictionStep = "1m"
+)
+
+// Bounds of the history queried for prediction on every sync of each MemHpa
+const (
+	MaxPredictionWindow = 6 * time.Hour
+	// Max samples of each pod, i.e. window / step
+	MaxPredictionSamples = 360
+)
+
+// Size replicas for memory of pods forecast from its recent trend, e.g. to scale up before a steady climb of
+// memory causes OOMKills. Only Memory metrics are forecast, with history queried from Prometheus.
+type PredictionSpec struct {
+	// Linear or Holt, default Linear
+	Method PredictionMethod `json:"method,omitempty"`
+	// How far ahead memory is forecast, e.g. 10m
+	Horizon string `json:"horizon"`
+	// Length of history the trend is fitted to, default 30m
+	Window string `json:"window,omitempty"`
+	// Resolution of history, default 1m
+	Step string `json:"step,omitempty"`
+}
+
+// Whether the controller scales the target
+type ScalingMode string
+
+const (
+	// Scale the target
+	AutoScalingMode ScalingMode = "Auto"
+	// Compute and publish desired replicas in status and events, but don't scale the target
+	RecommendOnlyScalingMode ScalingMode = "RecommendOnly"
+	// Neither compute nor scale
+	OffScalingMode ScalingMode = "Off"
+)
+
+// Type of a condition of MemHpa status
+type MemHPAConditionType string
+
+const (
+	// Whether the controller is able to get and update the scale of the target,
+	// and whether scaling is held back by stabilization windows
+	AbleToScale MemHPAConditionType = "AbleToScale"
+	// Whether the controller is able to calculate desired replicas from metrics
+	ScalingActive MemHPAConditionType = "ScalingActive"
+	// Whether desired replicas are limited by min/max replicas or the policies of behavior
+	ScalingLimited MemHPAConditionType = "ScalingLimited"
 )
 
+type MemHPACondition struct {
+	Type MemHPAConditionType `json:"type"`
+	// True, False or Unknown
+	Status v1.ConditionStatus `json:"status"`
+	// Last time the condition transitioned from one status to another
+	LastTransitionTime unversioned.Time `json:"lastTransitionTime,omitempty"`
+	// Reason in CamelCase for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Human-readable details of the last transition
+	Message string `json:"message,omitempty"`
+}
+
 type MemHpa struct {
 	unversioned.TypeMeta `json:",inline"`
 	// There is a bug when using 3rd party resources: https://github.com/kubernetes/client-go/issues/8
@@ -29,6 +261,40 @@ type MemHPASpec struct {
 	MinReplicas *int32 `json:"minReplicas,omitempty"`
 	MaxReplicas int32 `json:"maxReplicas"`
 	TargetUtilizationPercentage *int32 `json:"targetUtilizationPercentage,omitempty"`
+	// Target of average memory per pod, e.g. 1536Mi. It takes precedence over TargetUtilizationPercentage.
+	TargetAverageValue *resource.Quantity `json:"targetAverageValue,omitempty"`
+	// Go template of PromQL to query memory of pods, only used by Prometheus metrics backend.
+	// It receives .Namespace, .TargetName, .Selector, .PodLabel, .PodRegex, .PodLabelMatchers, .Signal, .Series,
+	// .ContainerLabel and .ContainerMatchers.
+	// The default template of controller is used if empty.
+	MetricQuery string `json:"metricQuery,omitempty"`
+	// Memory signal to calculate utilization. The default signal of the metrics backend is used if empty,
+	// which is workingSet for resource metrics API and usage for the others.
+	MemorySignal MemorySignal `json:"memorySignal,omitempty"`
+	// Utilization is calculated relative to memory limits or requests of containers, default limits
+	UtilizationBase UtilizationBase `json:"utilizationBase,omitempty"`
+	// Skip containers without the utilization base instead of failing the calculation
+	SkipContainersWithoutBase bool `json:"skipContainersWithoutBase,omitempty"`
+	// Only containers with these names are considered if it is not empty
+	IncludeContainers []string `json:"includeContainers,omitempty"`
+	// Containers with these names are not considered, e.g. sidecars
+	ExcludeContainers []string `json:"excludeContainers,omitempty"`
+	// Metrics to scale on. Desired replicas is the maximum of the proposals of all metrics.
+	// If it is empty, memory with the targets above is used.
+	Metrics []MetricSpec `json:"metrics,omitempty"`
+	// Stabilization windows and rate limits of scaling up and down
+	Behavior *MemHPAScalingBehavior `json:"behavior,omitempty"`
+	// Replicas of the target restored when the MemHpa is deleted, the target is left as it is if nil
+	ReplicasOnDelete *int32 `json:"replicasOnDelete,omitempty"`
+	// Whether the target is scaled, default Auto
+	Mode ScalingMode `json:"mode,omitempty"`
+	// Overrides of min and max replicas, the first active one in the list is applied
+	Schedules []ScheduleSpec `json:"schedules,omitempty"`
+	// Scale the target to zero while it is idle, minReplicas may be 0 only if it is set
+	ScaleToZero *ScaleToZeroSpec `json:"scaleToZero,omitempty"`
+	// Size replicas for memory forecast from its trend. Forecasts below current memory are ignored,
+	// so prediction only scales up earlier.
+	Prediction *PredictionSpec `json:"prediction,omitempty"`
 }
 
 type MemHPAScalerStatus struct {
@@ -36,7 +302,28 @@ type MemHPAScalerStatus struct {
 	LastScaleTime *unversioned.Time `json:"lastScaleTime,omitempty"`
 	CurrentReplicas int32 `json:"currentReplicas"`
 	DesiredReplicas int32 `json:"desiredReplicas"`
-	CurrentUtilizationPercentage int32 `json:"currentCPUUtilizationPercentage"`
+	// Min replicas in effect, i.e. .spec.minReplicas validated or overridden by the active schedule
+	MinReplicas int32 `json:"minReplicas"`
+	CurrentUtilizationPercentage int32 `json:"currentUtilizationPercentage"`
+	// Average memory per pod, only set if .spec.targetAverageValue is set
+	CurrentAverageValue *resource.Quantity `json:"currentAverageValue,omitempty"`
+	// Memory signal by which current utilization was calculated
+	MemorySignal MemorySignal `json:"memorySignal,omitempty"`
+	// Current values of .spec.metrics in the same order
+	CurrentMetrics []MetricStatus `json:"currentMetrics,omitempty"`
+	// Latest observations of the state of the autoscaler
+	Conditions []MemHPACondition `json:"conditions,omitempty"`
+	// Mode in effect, it is RecommendOnly if the controller runs with -dry-run
+	Mode ScalingMode `json:"mode,omitempty"`
+	// Why desiredReplicas differs from currentReplicas
+	Reason string `json:"reason,omitempty"`
+	// Name of the schedule in .spec.schedules applied, empty if none is active
+	ActiveSchedule string `json:"activeSchedule,omitempty"`
+	// Since when the target has been idle by .spec.scaleToZero, nil if it is not idle
+	IdleSince *unversioned.Time `json:"idleSince,omitempty"`
+	// Forecast of memory by .spec.prediction, only set if it succeeded
+	PredictedUtilizationPercentage *int32 `json:"predictedUtilizationPercentage,omitempty"`
+	PredictedAverageValue *resource.Quantity `json:"predictedAverageValue,omitempty"`
 }
 
 type MemHpaList struct {
@@ -45,6 +332,151 @@ type MemHpaList struct {
 	Items []MemHpa `json:"items"`
 }
 
+// Return metrics to scale on: .spec.metrics, or memory with the targets of spec if it is empty
+func (s *MemHPASpec) GetMetrics() []MetricSpec {
+	if 0 < len(s.Metrics) {
+		return s.Metrics
+	}
+	return []MetricSpec{
+		{
+			Type: MemoryMetricSourceType,
+			TargetUtilizationPercentage: s.TargetUtilizationPercentage,
+			TargetAverageValue: s.TargetAverageValue,
+			Query: s.MetricQuery,
+		},
+	}
+}
+
+// Return the scale up rules of behavior with defaults of the unset fields:
+// window 3m, at most 100% are added in a minute, see also GetScaleUpLimitMinimum()
+func (s *MemHPASpec) GetScaleUpRules() HPAScalingRules {
+	var rules *HPAScalingRules
+	if nil != s.Behavior {
+		rules = s.Behavior.ScaleUp
+	}
+	return withDefaultRules(rules, DefaultScaleUpStabilizationWindowSeconds, []HPAScalingPolicy{
+		{Type: PercentScalingPolicy, Value: 100, PeriodSeconds: DefaultScalingPolicyPeriodSeconds},
+	})
+}
+
+// Return the min replicas allowed by scale up policies: DefaultScaleUpLimitMinimum with the default policy,
+// so that the default limit is max(2 * current, 4) as in earlier versions, or 0 if policies are set
+func (s *MemHPASpec) GetScaleUpLimitMinimum() int32 {
+	if nil != s.Behavior && nil != s.Behavior.ScaleUp && 0 < len(s.Behavior.ScaleUp.Policies) {
+		return 0
+	}
+	return DefaultScaleUpLimitMinimum
+}
+
+// Return the scale down rules of behavior with defaults of the unset fields:
+// window 5m, up to 100% of pods are removed in a minute
+func (s *MemHPASpec) GetScaleDownRules() HPAScalingRules {
+	var rules *HPAScalingRules
+	if nil != s.Behavior {
+		rules = s.Behavior.ScaleDown
+	}
+	return withDefaultRules(rules, DefaultScaleDownStabilizationWindowSeconds, []HPAScalingPolicy{
+		{Type: PercentScalingPolicy, Value: 100, PeriodSeconds: DefaultScalingPolicyPeriodSeconds},
+	})
+}
+
+// Parse the cron expression, time zone and duration of the schedule
+func (s *ScheduleSpec) Parse() (*cron.Schedule, *time.Location, time.Duration, error) {
+	schedule, err := cron.Parse(s.Schedule)
+	if nil != err {
+		return nil, nil, 0, err
+	}
+	location := time.UTC
+	if "" != s.TimeZone {
+		if location, err = time.LoadLocation(s.TimeZone); nil != err {
+			return nil, nil, 0, fmt.Errorf("invalid time zone %q: %v", s.TimeZone, err)
+		}
+	}
+	duration, err := time.ParseDuration(s.Duration)
+	if nil != err {
+		return nil, nil, 0, fmt.Errorf("invalid duration %q: %v", s.Duration, err)
+	}
+	if duration <= 0 {
+		return nil, nil, 0, fmt.Errorf("duration %q must be positive", s.Duration)
+	}
+	return schedule, location, duration, nil
+}
+
+// Parse the idle duration of the rule
+func (s *ScaleToZeroSpec) GetIdleDuration() (time.Duration, error) {
+	duration, err := time.ParseDuration(s.IdleDuration)
+	if nil != err {
+		return 0, fmt.Errorf("invalid duration %q: %v", s.IdleDuration, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", s.IdleDuration)
+	}
+	return duration, nil
+}
+
+// Return replicas the target is woken up to, default 1
+func (s *ScaleToZeroSpec) GetWakeReplicas() int32 {
+	if nil == s.WakeReplicas {
+		return 1
+	}
+	return *s.WakeReplicas
+}
+
+// Parse the horizon, window and step of the prediction with defaults of the unset fields.
+// The window must not exceed MaxPredictionWindow or MaxPredictionSamples steps.
+func (p *PredictionSpec) Parse() (time.Duration, time.Duration, time.Duration, error) {
+	window, step := p.Window, p.Step
+	if "" == window {
+		window = DefaultPredictionWindow
+	}
+	if "" == step {
+		step = DefaultPredictionStep
+	}
+	durations := make([]time.Duration, 0, 3)
+	for _, value := range []string{p.Horizon, window, step} {
+		duration, err := time.ParseDuration(value)
+		if nil != err {
+			return 0, 0, 0, fmt.Errorf("invalid duration %q: %v", value, err)
+		}
+		if duration <= 0 {
+			return 0, 0, 0, fmt.Errorf("duration %q must be positive", value)
+		}
+		durations = append(durations, duration)
+	}
+	if durations[1] > MaxPredictionWindow {
+		return 0, 0, 0, fmt.Errorf("window %q must not be longer than %v", window, MaxPredictionWindow)
+	}
+	if durations[1] / durations[2] > MaxPredictionSamples {
+		return 0, 0, 0, fmt.Errorf("window %q must not be more than %d steps of %q", window, MaxPredictionSamples, step)
+	}
+	return durations[0], durations[1], durations[2], nil
+}
+
+// Return the prediction method, default Linear
+func (p *PredictionSpec) GetMethod() PredictionMethod {
+	if "" == p.Method {
+		return LinearPredictionMethod
+	}
+	return p.Method
+}
+
+func withDefaultRules(rules *HPAScalingRules, window int32, policies []HPAScalingPolicy) HPAScalingRules {
+	result := HPAScalingRules{}
+	if nil != rules {
+		result = *rules
+	}
+	if nil == result.StabilizationWindowSeconds {
+		result.StabilizationWindowSeconds = &window
+	}
+	if "" == result.SelectPolicy {
+		result.SelectPolicy = MaxPolicySelect
+	}
+	if 0 == len(result.Policies) {
+		result.Policies = policies
+	}
+	return result
+}
+
 // Implement runtime.Object interface
 func (m *MemHpa) GetObjectKind() unversioned.ObjectKind {
 	return &m.TypeMeta
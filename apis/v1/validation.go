@@ -0,0 +1,236 @@
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/1.4/pkg/util/validation/field"
+)
+
+// Validate spec of the MemHpa, defaults should be set before
+func Validate(hpa *MemHpa) field.ErrorList {
+	return ValidateSpec(&hpa.Spec, field.NewPath("spec"))
+}
+
+func ValidateSpec(spec *MemHPASpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if "" == spec.ScaleTargetRef.Kind {
+		errs = append(errs, field.Required(path.Child("scaleTargetRef", "kind"), ""))
+	}
+	if "" == spec.ScaleTargetRef.Name {
+		errs = append(errs, field.Required(path.Child("scaleTargetRef", "name"), ""))
+	}
+	if nil == spec.MinReplicas {
+		errs = append(errs, field.Required(path.Child("minReplicas"), ""))
+	} else {
+		if *spec.MinReplicas < 0 || (0 == *spec.MinReplicas && nil == spec.ScaleToZero) {
+			errs = append(errs, field.Invalid(path.Child("minReplicas"), *spec.MinReplicas,
+				"must be at least 1, or 0 with scaleToZero"))
+		}
+		if spec.MaxReplicas < *spec.MinReplicas {
+			errs = append(errs, field.Invalid(path.Child("maxReplicas"), spec.MaxReplicas,
+				"must be greater than or equal to minReplicas"))
+		}
+	}
+	if nil != spec.TargetAverageValue && spec.TargetAverageValue.Sign() <= 0 {
+		errs = append(errs, field.Invalid(path.Child("targetAverageValue"), spec.TargetAverageValue.String(),
+			"must be positive"))
+	}
+	if nil == spec.TargetAverageValue && nil == spec.TargetUtilizationPercentage {
+		errs = append(errs, field.Required(path.Child("targetUtilizationPercentage"),
+			"either targetUtilizationPercentage or targetAverageValue is required"))
+	}
+	if nil != spec.TargetUtilizationPercentage &&
+		(*spec.TargetUtilizationPercentage < 1 || *spec.TargetUtilizationPercentage > 100) {
+
+		errs = append(errs, field.Invalid(path.Child("targetUtilizationPercentage"),
+			*spec.TargetUtilizationPercentage, "must be between 1 and 100"))
+	}
+	switch spec.MemorySignal {
+	case "", MemorySignalUsage, MemorySignalWorkingSet, MemorySignalRSS, MemorySignalUsageWithoutCache:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("memorySignal"), spec.MemorySignal, []string{
+			string(MemorySignalUsage), string(MemorySignalWorkingSet), string(MemorySignalRSS),
+			string(MemorySignalUsageWithoutCache),
+		}))
+	}
+	switch spec.UtilizationBase {
+	case "", UtilizationBaseLimits, UtilizationBaseRequests, UtilizationBaseLimitsOrRequests:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("utilizationBase"), spec.UtilizationBase, []string{
+			string(UtilizationBaseLimits), string(UtilizationBaseRequests), string(UtilizationBaseLimitsOrRequests),
+		}))
+	}
+	for i := range spec.Metrics {
+		errs = append(errs, ValidateMetric(&spec.Metrics[i], path.Child("metrics").Index(i))...)
+	}
+	if nil != spec.Behavior {
+		errs = append(errs, ValidateScalingRules(spec.Behavior.ScaleUp, path.Child("behavior", "scaleUp"))...)
+		errs = append(errs, ValidateScalingRules(spec.Behavior.ScaleDown, path.Child("behavior", "scaleDown"))...)
+	}
+	switch spec.Mode {
+	case "", AutoScalingMode, RecommendOnlyScalingMode, OffScalingMode:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("mode"), spec.Mode, []string{
+			string(AutoScalingMode), string(RecommendOnlyScalingMode), string(OffScalingMode),
+		}))
+	}
+	names := map[string]bool{}
+	for i := range spec.Schedules {
+		schedulePath := path.Child("schedules").Index(i)
+		errs = append(errs, ValidateSchedule(&spec.Schedules[i], schedulePath)...)
+		if names[spec.Schedules[i].Name] {
+			errs = append(errs, field.Duplicate(schedulePath.Child("name"), spec.Schedules[i].Name))
+		}
+		names[spec.Schedules[i].Name] = true
+	}
+	if nil != spec.ScaleToZero {
+		errs = append(errs, ValidateScaleToZero(spec.ScaleToZero, spec.MaxReplicas, path.Child("scaleToZero"))...)
+	}
+	if nil != spec.Prediction {
+		errs = append(errs, ValidatePrediction(spec.Prediction, path.Child("prediction"))...)
+	}
+	if nil != spec.ReplicasOnDelete && *spec.ReplicasOnDelete < 0 {
+		errs = append(errs, field.Invalid(path.Child("replicasOnDelete"), *spec.ReplicasOnDelete,
+			"must not be negative"))
+	}
+	return errs
+}
+
+func ValidateMetric(m *MetricSpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	switch m.Type {
+	case MemoryMetricSourceType, CPUMetricSourceType:
+	case PrometheusMetricSourceType:
+		if "" == m.Query {
+			errs = append(errs, field.Required(path.Child("query"), "required by Prometheus metrics"))
+		}
+		if nil == m.TargetAverageValue {
+			errs = append(errs, field.Required(path.Child("targetAverageValue"), "required by Prometheus metrics"))
+		}
+	default:
+		return append(errs, field.NotSupported(path.Child("type"), m.Type, []string{
+			string(MemoryMetricSourceType), string(CPUMetricSourceType), string(PrometheusMetricSourceType),
+		}))
+	}
+	if nil != m.TargetAverageValue {
+		if m.TargetAverageValue.Sign() <= 0 {
+			errs = append(errs, field.Invalid(path.Child("targetAverageValue"), m.TargetAverageValue.String(),
+				"must be positive"))
+		}
+	} else if nil == m.TargetUtilizationPercentage {
+		errs = append(errs, field.Required(path.Child("targetUtilizationPercentage"),
+			"either targetUtilizationPercentage or targetAverageValue is required"))
+	} else if *m.TargetUtilizationPercentage < 1 {
+		errs = append(errs, field.Invalid(path.Child("targetUtilizationPercentage"),
+			*m.TargetUtilizationPercentage, "must be positive"))
+	}
+	return errs
+}
+
+// Validate scaling rules of a direction, nil rules are valid
+func ValidateScalingRules(rules *HPAScalingRules, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if nil == rules {
+		return errs
+	}
+	if nil != rules.StabilizationWindowSeconds && *rules.StabilizationWindowSeconds < 0 {
+		errs = append(errs, field.Invalid(path.Child("stabilizationWindowSeconds"),
+			*rules.StabilizationWindowSeconds, "must not be negative"))
+	} else if nil != rules.StabilizationWindowSeconds &&
+		MaxStabilizationWindowSeconds < *rules.StabilizationWindowSeconds {
+
+		errs = append(errs, field.Invalid(path.Child("stabilizationWindowSeconds"),
+			*rules.StabilizationWindowSeconds, fmt.Sprintf("must not be greater than %d",
+				MaxStabilizationWindowSeconds)))
+	}
+	switch rules.SelectPolicy {
+	case "", MaxPolicySelect, MinPolicySelect, DisabledPolicySelect:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("selectPolicy"), rules.SelectPolicy, []string{
+			string(MaxPolicySelect), string(MinPolicySelect), string(DisabledPolicySelect),
+		}))
+	}
+	for i, p := range rules.Policies {
+		policyPath := path.Child("policies").Index(i)
+		if PodsScalingPolicy != p.Type && PercentScalingPolicy != p.Type {
+			errs = append(errs, field.NotSupported(policyPath.Child("type"), p.Type, []string{
+				string(PodsScalingPolicy), string(PercentScalingPolicy),
+			}))
+		}
+		if p.Value < 1 {
+			errs = append(errs, field.Invalid(policyPath.Child("value"), p.Value, "must be positive"))
+		}
+		if p.PeriodSeconds < 1 {
+			errs = append(errs, field.Invalid(policyPath.Child("periodSeconds"), p.PeriodSeconds, "must be positive"))
+		} else if MaxScalingPolicyPeriodSeconds < p.PeriodSeconds {
+			errs = append(errs, field.Invalid(policyPath.Child("periodSeconds"), p.PeriodSeconds,
+				fmt.Sprintf("must not be greater than %d", MaxScalingPolicyPeriodSeconds)))
+		}
+	}
+	return errs
+}
+
+func ValidateSchedule(s *ScheduleSpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if "" == s.Name {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	if _, _, _, err := s.Parse(); nil != err {
+		errs = append(errs, field.Invalid(path, s.Schedule, err.Error()))
+	}
+	if nil == s.MinReplicas && nil == s.MaxReplicas {
+		errs = append(errs, field.Required(path.Child("minReplicas"), "either minReplicas or maxReplicas is required"))
+	}
+	if nil != s.MinReplicas && *s.MinReplicas < 1 {
+		errs = append(errs, field.Invalid(path.Child("minReplicas"), *s.MinReplicas, "must be at least 1"))
+	}
+	if nil != s.MaxReplicas {
+		if *s.MaxReplicas < 1 {
+			errs = append(errs, field.Invalid(path.Child("maxReplicas"), *s.MaxReplicas, "must be at least 1"))
+		} else if nil != s.MinReplicas && *s.MaxReplicas < *s.MinReplicas {
+			errs = append(errs, field.Invalid(path.Child("maxReplicas"), *s.MaxReplicas,
+				"must be greater than or equal to minReplicas"))
+		}
+	}
+	return errs
+}
+
+func ValidateScaleToZero(s *ScaleToZeroSpec, maxReplicas int32, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if s.IdleBelow.Sign() <= 0 {
+		errs = append(errs, field.Invalid(path.Child("idleBelow"), s.IdleBelow.String(), "must be positive"))
+	}
+	if _, err := s.GetIdleDuration(); nil != err {
+		errs = append(errs, field.Invalid(path.Child("idleDuration"), s.IdleDuration, err.Error()))
+	}
+	if "" == s.WakeQuery {
+		errs = append(errs, field.Required(path.Child("wakeQuery"), ""))
+	}
+	if nil != s.WakeReplicas && (*s.WakeReplicas < 1 || *s.WakeReplicas > maxReplicas) {
+		errs = append(errs, field.Invalid(path.Child("wakeReplicas"), *s.WakeReplicas,
+			"must be between 1 and maxReplicas"))
+	}
+	return errs
+}
+
+func ValidatePrediction(p *PredictionSpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	switch p.Method {
+	case "", LinearPredictionMethod, HoltPredictionMethod:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("method"), p.Method, []string{
+			string(LinearPredictionMethod), string(HoltPredictionMethod),
+		}))
+	}
+	if "" == p.Horizon {
+		return append(errs, field.Required(path.Child("horizon"), ""))
+	}
+	_, window, step, err := p.Parse()
+	if nil != err {
+		return append(errs, field.Invalid(path, *p, err.Error()))
+	}
+	if window < 3 * step {
+		errs = append(errs, field.Invalid(path.Child("window"), p.Window, "must be at least 3 steps"))
+	}
+	return errs
+}
@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"testing"
+
+	"k8s.io/client-go/1.4/pkg/util/validation/field"
+)
+
+func seconds(value int32) *int32 {
+	return &value
+}
+
+func TestValidateScalingRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rules *HPAScalingRules
+		valid bool
+	}{
+		{"nil", nil, true},
+		{"max window", &HPAScalingRules{StabilizationWindowSeconds: seconds(MaxStabilizationWindowSeconds)}, true},
+		{"window too long", &HPAScalingRules{StabilizationWindowSeconds: seconds(MaxStabilizationWindowSeconds + 1)},
+			false},
+		{"negative window", &HPAScalingRules{StabilizationWindowSeconds: seconds(-1)}, false},
+		{"max period", &HPAScalingRules{Policies: []HPAScalingPolicy{
+			{Type: PodsScalingPolicy, Value: 1, PeriodSeconds: MaxScalingPolicyPeriodSeconds}}}, true},
+		{"period too long", &HPAScalingRules{Policies: []HPAScalingPolicy{
+			{Type: PodsScalingPolicy, Value: 1, PeriodSeconds: MaxScalingPolicyPeriodSeconds + 1}}}, false},
+		{"zero period", &HPAScalingRules{Policies: []HPAScalingPolicy{
+			{Type: PercentScalingPolicy, Value: 100, PeriodSeconds: 0}}}, false},
+		{"unknown select policy", &HPAScalingRules{SelectPolicy: "Any"}, false},
+	}
+	for _, test := range tests {
+		errs := ValidateScalingRules(test.rules, field.NewPath("spec", "behavior", "scaleUp"))
+		if test.valid != (0 == len(errs)) {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, errs)
+		}
+	}
+}
+
+func TestValidatePrediction(t *testing.T) {
+	tests := []struct {
+		name string
+		prediction *PredictionSpec
+		valid bool
+		// whether Parse() used by the controller accepts it
+		parsed bool
+	}{
+		{"defaults", &PredictionSpec{Horizon: "10m"}, true, true},
+		{"without horizon", &PredictionSpec{}, false, false},
+		{"unknown method", &PredictionSpec{Method: "Cubic", Horizon: "10m"}, false, true},
+		{"max window", &PredictionSpec{Horizon: "10m", Window: "6h"}, true, true},
+		{"window too long", &PredictionSpec{Horizon: "10m", Window: "6h1m"}, false, false},
+		{"max steps", &PredictionSpec{Horizon: "10m", Window: "1h", Step: "10s"}, true, true},
+		{"too many steps", &PredictionSpec{Horizon: "10m", Window: "1h", Step: "9s"}, false, false},
+		{"too few steps", &PredictionSpec{Horizon: "10m", Window: "2m"}, false, true},
+		{"negative step", &PredictionSpec{Horizon: "10m", Step: "-1m"}, false, false},
+	}
+	for _, test := range tests {
+		errs := ValidatePrediction(test.prediction, field.NewPath("spec", "prediction"))
+		if test.valid != (0 == len(errs)) {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, errs)
+		}
+		if _, _, _, err := test.prediction.Parse(); test.parsed != (nil == err) {
+			t.Errorf("%s: expected parsed %v, got %v", test.name, test.parsed, err)
+		}
+	}
+}
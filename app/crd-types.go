@@ -0,0 +1,285 @@
+package app
+
+import (
+	"memhpa/apis/v1"
+)
+
+// Subset of apiextensions.k8s.io/v1 CustomResourceDefinition, see "Vendored client-go" in README.md
+type customResourceDefinition struct {
+	APIVersion string `json:"apiVersion"`
+	Kind string `json:"kind"`
+	Metadata crdMeta `json:"metadata"`
+	Spec crdSpec `json:"spec"`
+	Status *crdStatus `json:"status,omitempty"`
+}
+
+type crdMeta struct {
+	Name string `json:"name"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type crdSpec struct {
+	Group string `json:"group"`
+	Names crdNames `json:"names"`
+	Scope string `json:"scope"`
+	Versions []crdVersion `json:"versions"`
+}
+
+type crdNames struct {
+	Plural string `json:"plural"`
+	Singular string `json:"singular"`
+	Kind string `json:"kind"`
+	ListKind string `json:"listKind"`
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+type crdVersion struct {
+	Name string `json:"name"`
+	Served bool `json:"served"`
+	Storage bool `json:"storage"`
+	Schema crdValidation `json:"schema"`
+	Subresources *crdSubresources `json:"subresources,omitempty"`
+	AdditionalPrinterColumns []crdColumn `json:"additionalPrinterColumns,omitempty"`
+}
+
+type crdValidation struct {
+	OpenAPIV3Schema *jsonSchema `json:"openAPIV3Schema"`
+}
+
+type crdSubresources struct {
+	Status *struct{} `json:"status,omitempty"`
+	Scale *crdScale `json:"scale,omitempty"`
+}
+
+type crdScale struct {
+	SpecReplicasPath string `json:"specReplicasPath"`
+	StatusReplicasPath string `json:"statusReplicasPath"`
+}
+
+type crdColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	JSONPath string `json:"jsonPath"`
+	Description string `json:"description,omitempty"`
+	Priority int32 `json:"priority,omitempty"`
+}
+
+type crdStatus struct {
+	Conditions []struct {
+		Type string `json:"type"`
+		Status string `json:"status"`
+		Reason string `json:"reason,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"conditions,omitempty"`
+}
+
+// Structural OpenAPI v3 schema
+type jsonSchema struct {
+	Type string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Properties map[string]jsonSchema `json:"properties,omitempty"`
+	Items *jsonSchema `json:"items,omitempty"`
+	Required []string `json:"required,omitempty"`
+	Enum []string `json:"enum,omitempty"`
+	Minimum *int64 `json:"minimum,omitempty"`
+	Maximum *int64 `json:"maximum,omitempty"`
+	Format string `json:"format,omitempty"`
+	IntOrString bool `json:"x-kubernetes-int-or-string,omitempty"`
+	AnyOf []jsonSchema `json:"anyOf,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+func schemaObject(properties map[string]jsonSchema, required ...string) jsonSchema {
+	return jsonSchema{Type: "object", Properties: properties, Required: required}
+}
+
+func schemaArray(items jsonSchema) jsonSchema {
+	return jsonSchema{Type: "array", Items: &items}
+}
+
+func schemaString(enum ...string) jsonSchema {
+	return jsonSchema{Type: "string", Enum: enum}
+}
+
+func schemaBool() jsonSchema {
+	return jsonSchema{Type: "boolean"}
+}
+
+// Integer with optional bounds, nil means unbounded
+func schemaInt(min, max *int64) jsonSchema {
+	return jsonSchema{Type: "integer", Format: "int32", Minimum: min, Maximum: max}
+}
+
+func schemaQuantity() jsonSchema {
+	return jsonSchema{
+		IntOrString: true,
+		AnyOf: []jsonSchema{{Type: "integer"}, {Type: "string"}},
+		Pattern: `^(\+|-)?(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\+|-)?(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))))?$`,
+	}
+}
+
+func schemaTime() jsonSchema {
+	return jsonSchema{Type: "string", Format: "date-time"}
+}
+
+func bound(value int64) *int64 {
+	return &value
+}
+
+// Schema of MemHpa, it should be kept in sync with memhpa/apis/v1
+func memHPASchema() *jsonSchema {
+	scalingRules := schemaObject(map[string]jsonSchema{
+		"stabilizationWindowSeconds": schemaInt(bound(0), bound(v1.MaxStabilizationWindowSeconds)),
+		"selectPolicy": schemaString(string(v1.MaxPolicySelect), string(v1.MinPolicySelect),
+			string(v1.DisabledPolicySelect)),
+		"policies": schemaArray(schemaObject(map[string]jsonSchema{
+			"type": schemaString(string(v1.PodsScalingPolicy), string(v1.PercentScalingPolicy)),
+			"value": schemaInt(bound(1), nil),
+			"periodSeconds": schemaInt(bound(1), bound(v1.MaxScalingPolicyPeriodSeconds)),
+		}, "type", "value", "periodSeconds")),
+	})
+
+	spec := schemaObject(map[string]jsonSchema{
+		"scaleTargetRef": schemaObject(map[string]jsonSchema{
+			"apiVersion": schemaString(),
+			"kind": schemaString(),
+			"name": schemaString(),
+		}, "kind", "name"),
+		"minReplicas": schemaInt(bound(0), nil),
+		"maxReplicas": schemaInt(bound(1), nil),
+		"targetUtilizationPercentage": schemaInt(bound(1), bound(100)),
+		"targetAverageValue": schemaQuantity(),
+		"metricQuery": schemaString(),
+		"memorySignal": schemaString(string(v1.MemorySignalUsage), string(v1.MemorySignalWorkingSet),
+			string(v1.MemorySignalRSS), string(v1.MemorySignalUsageWithoutCache)),
+		"utilizationBase": schemaString(string(v1.UtilizationBaseLimits), string(v1.UtilizationBaseRequests),
+			string(v1.UtilizationBaseLimitsOrRequests)),
+		"skipContainersWithoutBase": schemaBool(),
+		"includeContainers": schemaArray(schemaString()),
+		"excludeContainers": schemaArray(schemaString()),
+		"metrics": schemaArray(schemaObject(map[string]jsonSchema{
+			"type": schemaString(string(v1.MemoryMetricSourceType), string(v1.CPUMetricSourceType),
+				string(v1.PrometheusMetricSourceType)),
+			"targetUtilizationPercentage": schemaInt(bound(1), nil),
+			"targetAverageValue": schemaQuantity(),
+			"query": schemaString(),
+		}, "type")),
+		"behavior": schemaObject(map[string]jsonSchema{
+			"scaleUp": scalingRules,
+			"scaleDown": scalingRules,
+		}),
+		"replicasOnDelete": schemaInt(bound(0), nil),
+		"mode": schemaString(string(v1.AutoScalingMode), string(v1.RecommendOnlyScalingMode),
+			string(v1.OffScalingMode)),
+		"schedules": schemaArray(schemaObject(map[string]jsonSchema{
+			"name": schemaString(),
+			"schedule": schemaString(),
+			"timeZone": schemaString(),
+			"duration": schemaString(),
+			"minReplicas": schemaInt(bound(1), nil),
+			"maxReplicas": schemaInt(bound(1), nil),
+		}, "name", "schedule", "duration")),
+		"scaleToZero": schemaObject(map[string]jsonSchema{
+			"idleBelow": schemaQuantity(),
+			"idleDuration": schemaString(),
+			"wakeQuery": schemaString(),
+			"wakeReplicas": schemaInt(bound(1), nil),
+		}, "idleBelow", "idleDuration", "wakeQuery"),
+		"prediction": schemaObject(map[string]jsonSchema{
+			"method": schemaString(string(v1.LinearPredictionMethod), string(v1.HoltPredictionMethod)),
+			"horizon": schemaString(),
+			"window": schemaString(),
+			"step": schemaString(),
+		}, "horizon"),
+	}, "scaleTargetRef", "maxReplicas")
+
+	status := schemaObject(map[string]jsonSchema{
+		"observedGeneration": {Type: "integer", Format: "int64"},
+		"lastScaleTime": schemaTime(),
+		"currentReplicas": schemaInt(nil, nil),
+		"desiredReplicas": schemaInt(nil, nil),
+		"minReplicas": schemaInt(nil, nil),
+		"currentUtilizationPercentage": schemaInt(nil, nil),
+		"currentAverageValue": schemaQuantity(),
+		"memorySignal": schemaString(),
+		"currentMetrics": schemaArray(schemaObject(map[string]jsonSchema{
+			"type": schemaString(),
+			"currentUtilizationPercentage": schemaInt(nil, nil),
+			"currentAverageValue": schemaQuantity(),
+			"predictedUtilizationPercentage": schemaInt(nil, nil),
+			"predictedAverageValue": schemaQuantity(),
+		})),
+		"conditions": schemaArray(schemaObject(map[string]jsonSchema{
+			"type": schemaString(string(v1.AbleToScale), string(v1.ScalingActive), string(v1.ScalingLimited)),
+			"status": schemaString("True", "False", "Unknown"),
+			"lastTransitionTime": schemaTime(),
+			"reason": schemaString(),
+			"message": schemaString(),
+		}, "type", "status")),
+		"mode": schemaString(),
+		"reason": schemaString(),
+		"activeSchedule": schemaString(),
+		"idleSince": schemaTime(),
+		"predictedUtilizationPercentage": schemaInt(nil, nil),
+		"predictedAverageValue": schemaQuantity(),
+	})
+
+	schema := schemaObject(map[string]jsonSchema{
+		"apiVersion": schemaString(),
+		"kind": schemaString(),
+		"metadata": {Type: "object"},
+		"spec": spec,
+		"status": status,
+	}, "spec")
+	return &schema
+}
+
+func newCustomResourceDefinition() *customResourceDefinition {
+	return &customResourceDefinition{
+		APIVersion: "apiextensions.k8s.io/v1",
+		Kind: "CustomResourceDefinition",
+		Metadata: crdMeta{Name: v1.MemHPAResourcesCRDName},
+		Spec: crdSpec{
+			Group: v1.MemHPAResourcesGroup,
+			Names: crdNames{
+				Plural: v1.MemHPAResourcesName,
+				Singular: v1.MemHPAResourcesSingularName,
+				Kind: v1.MemHPAResourcesKind,
+				ListKind: v1.MemHPAResourcesKind + "List",
+				ShortNames: []string{v1.MemHPAResourcesShortName},
+			},
+			Scope: "Namespaced",
+			Versions: []crdVersion{
+				{
+					Name: v1.MemHPAResourcesVersion,
+					Served: true,
+					Storage: true,
+					Schema: crdValidation{OpenAPIV3Schema: memHPASchema()},
+					Subresources: &crdSubresources{
+						Status: &struct{}{},
+						// scaling a MemHpa sets its min replicas, and the min replicas in effect are observed
+						Scale: &crdScale{
+							SpecReplicasPath: ".spec.minReplicas",
+							StatusReplicasPath: ".status.minReplicas",
+						},
+					},
+					AdditionalPrinterColumns: []crdColumn{
+						{Name: "Reference", Type: "string", JSONPath: ".spec.scaleTargetRef.name"},
+						{Name: "Target", Type: "integer", JSONPath: ".spec.targetUtilizationPercentage"},
+						{Name: "Current", Type: "integer", JSONPath: ".status.currentUtilizationPercentage"},
+						{Name: "MinPods", Type: "integer", JSONPath: ".spec.minReplicas"},
+						{Name: "MaxPods", Type: "integer", JSONPath: ".spec.maxReplicas"},
+						{Name: "Replicas", Type: "integer", JSONPath: ".status.currentReplicas"},
+						{Name: "Signal", Type: "string", JSONPath: ".status.memorySignal", Priority: 1},
+						{Name: "Mode", Type: "string", JSONPath: ".status.mode", Priority: 1},
+						{Name: "Predicted", Type: "integer", JSONPath: ".status.predictedUtilizationPercentage",
+							Priority: 1},
+						{Name: "Desired", Type: "integer", JSONPath: ".status.desiredReplicas", Priority: 1},
+						{Name: "Schedule", Type: "string", JSONPath: ".status.activeSchedule", Priority: 1},
+						{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+					},
+				},
+			},
+		},
+	}
+}
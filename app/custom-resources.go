@@ -1,51 +1,101 @@
 package app
 
 import (
-	"net/http"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	"memhpa/apis/v1"
 
 	"github.com/golang/glog"
 
-	"k8s.io/client-go/1.4/kubernetes/typed/extensions/v1beta1"
-	v1beta1types "k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
-	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/rest"
 	"k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/util/wait"
 )
 
-// Create custom resource if doesn't exist
-func CreateMemHPAResourceGroup(getter v1beta1.ThirdPartyResourcesGetter) error {
-	_, err := getter.ThirdPartyResources().Get(v1.MemHPAResourcesMetaName)
-	if nil != err {
-		if k8sErr, ok := err.(*errors.StatusError); ok && http.StatusNotFound == k8sErr.ErrStatus.Code {
-			if _, err := getter.ThirdPartyResources().Create(newCustomResource()); nil != err {
-				glog.Errorf("Failed to create custom mem-hpa resources: %#v\n", err)
-				return err
-			}
-			glog.Infoln("Succeed to create custom mem-hpa resources")
-			return nil
-		}
-		glog.Errorf("Failed to get custom mem-hpa resources: %#v\n", err)
+const crdAPIPath = "/apis/apiextensions.k8s.io/v1/customresourcedefinitions"
+
+// Create or update the CustomResourceDefinition of MemHpa and wait until it is established.
+// restClient is any client of the API server, only absolute paths are requested with it.
+func CreateMemHPAResourceGroup(restClient *rest.RESTClient) error {
+	if err := applyCRD(restClient); nil != err {
+		glog.Errorf("Failed to apply custom resource definition of mem-hpa: %#v\n", err)
+		return err
+	}
+	if err := waitForCRDEstablished(restClient); nil != err {
+		glog.Errorf("Custom resource definition of mem-hpa is not established: %#v\n", err)
 		return err
 	}
-	glog.Infoln("Custom mem-hpa resources already exists")
 	return nil
 }
 
-func CreateMemHPAResourceGroupOrDie(getter v1beta1.ThirdPartyResourcesGetter) {
-	if err := CreateMemHPAResourceGroup(getter); nil != err {
+func CreateMemHPAResourceGroupOrDie(restClient *rest.RESTClient) {
+	if err := CreateMemHPAResourceGroup(restClient); nil != err {
 		panic(err)
 	}
 }
 
-func newCustomResource() *v1beta1types.ThirdPartyResource {
-	return &v1beta1types.ThirdPartyResource{
-		ObjectMeta: v1types.ObjectMeta{
-			Name: v1.MemHPAResourcesMetaName,
-		},
-		Description: "Resources for controlling autoscale through memory limit",
-		Versions: []v1beta1types.APIVersion{
-			v1beta1types.APIVersion{v1.MemHPAResourcesVersion},
-		},
-	}
-}
\ No newline at end of file
+// Create the CRD, or update it if it exists so that its schema is up to date
+func applyCRD(restClient *rest.RESTClient) error {
+	crd := newCustomResourceDefinition()
+	existing, err := getCRD(restClient)
+	if nil != err && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if nil == existing {
+		data, err := json.Marshal(crd)
+		if nil != err {
+			return err
+		}
+		if _, err := restClient.Post().AbsPath(crdAPIPath).SetHeader("Content-Type", "application/json").
+			Body(data).DoRaw(); nil != err {
+			return err
+		}
+		glog.Infoln("Succeed to create custom resource definition of mem-hpa")
+		return nil
+	}
+
+	crd.Metadata.ResourceVersion = existing.Metadata.ResourceVersion
+	data, err := json.Marshal(crd)
+	if nil != err {
+		return err
+	}
+	if _, err := restClient.Put().AbsPath(crdAPIPath, v1.MemHPAResourcesCRDName).
+		SetHeader("Content-Type", "application/json").Body(data).DoRaw(); nil != err {
+		return err
+	}
+	glog.Infoln("Custom resource definition of mem-hpa already exists and was updated")
+	return nil
+}
+
+func getCRD(restClient *rest.RESTClient) (*customResourceDefinition, error) {
+	data, err := restClient.Get().AbsPath(crdAPIPath, v1.MemHPAResourcesCRDName).DoRaw()
+	if nil != err {
+		return nil, err
+	}
+	crd := &customResourceDefinition{}
+	if err := json.Unmarshal(data, crd); nil != err {
+		return nil, fmt.Errorf("unexpected custom resource definition: %v", err)
+	}
+	return crd, nil
+}
+
+func waitForCRDEstablished(restClient *rest.RESTClient) error {
+	return wait.PollImmediate(500 * time.Millisecond, 30 * time.Second, func() (bool, error) {
+		crd, err := getCRD(restClient)
+		if nil != err {
+			return false, err
+		}
+		if nil == crd.Status {
+			return false, nil
+		}
+		for _, c := range crd.Status.Conditions {
+			if "Established" == c.Type && "True" == c.Status {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
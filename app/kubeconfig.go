@@ -0,0 +1,135 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+
+	"k8s.io/client-go/1.4/rest"
+	clientcmdapi "k8s.io/client-go/1.4/tools/clientcmd/api"
+)
+
+// kubeConfig is the on-disk (v1) layout of a kubeconfig file, see "Vendored client-go" in README.md
+type kubeConfig struct {
+	CurrentContext string `json:"current-context"`
+	Clusters []struct {
+		Name    string  `json:"name"`
+		Cluster cluster `json:"cluster"`
+	} `json:"clusters"`
+	AuthInfos []struct {
+		Name     string   `json:"name"`
+		AuthInfo authInfo `json:"user"`
+	} `json:"users"`
+	Contexts []struct {
+		Name    string  `json:"name"`
+		Context kubeContext `json:"context"`
+	} `json:"contexts"`
+}
+
+type cluster struct {
+	Server string `json:"server"`
+	InsecureSkipTLSVerify bool `json:"insecure-skip-tls-verify,omitempty"`
+	CertificateAuthority string `json:"certificate-authority,omitempty"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+}
+
+type authInfo struct {
+	ClientCertificate string `json:"client-certificate,omitempty"`
+	ClientCertificateData []byte `json:"client-certificate-data,omitempty"`
+	ClientKey string `json:"client-key,omitempty"`
+	ClientKeyData []byte `json:"client-key-data,omitempty"`
+	Token string `json:"token,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	Impersonate string `json:"as,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	AuthProvider *clientcmdapi.AuthProviderConfig `json:"auth-provider,omitempty"`
+}
+
+type kubeContext struct {
+	Cluster string `json:"cluster"`
+	AuthInfo string `json:"user"`
+}
+
+// Build config to access k8s API.
+// The in-cluster config is used if neither master nor kubeconfig is specified.
+// Otherwise the kubeconfig file is loaded with the specified context (or current-context if it is empty),
+// and master overrides the server address of the cluster.
+func BuildConfig(master, kubeconfigPath, contextName string) (*rest.Config, error) {
+	if "" == kubeconfigPath {
+		if "" == master {
+			glog.Infoln("Neither -master nor -kubeconfig was specified, using in-cluster config")
+			return rest.InClusterConfig()
+		}
+		return &rest.Config{Host: master}, nil
+	}
+
+	data, err := ioutil.ReadFile(kubeconfigPath)
+	if nil != err {
+		return nil, err
+	}
+	kc := kubeConfig{}
+	if err := yaml.Unmarshal(data, &kc); nil != err {
+		return nil, fmt.Errorf("failed to decode kubeconfig %s: %v", kubeconfigPath, err)
+	}
+	baseDir := filepath.Dir(kubeconfigPath)
+
+	if "" == contextName {
+		contextName = kc.CurrentContext
+	}
+	var ctx *kubeContext
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Name == contextName {
+			ctx = &kc.Contexts[i].Context
+			break
+		}
+	}
+	if nil == ctx {
+		return nil, fmt.Errorf("context %q was not found in kubeconfig %s", contextName, kubeconfigPath)
+	}
+
+	config := &rest.Config{}
+	for _, c := range kc.Clusters {
+		if c.Name != ctx.Cluster {
+			continue
+		}
+		config.Host = c.Cluster.Server
+		config.Insecure = c.Cluster.InsecureSkipTLSVerify
+		config.CAFile = clientcmdapi.ResolvePath(c.Cluster.CertificateAuthority, baseDir)
+		config.CAData = c.Cluster.CertificateAuthorityData
+	}
+	for _, a := range kc.AuthInfos {
+		if a.Name != ctx.AuthInfo {
+			continue
+		}
+		config.CertFile = clientcmdapi.ResolvePath(a.AuthInfo.ClientCertificate, baseDir)
+		config.CertData = a.AuthInfo.ClientCertificateData
+		config.KeyFile = clientcmdapi.ResolvePath(a.AuthInfo.ClientKey, baseDir)
+		config.KeyData = a.AuthInfo.ClientKeyData
+		config.BearerToken = a.AuthInfo.Token
+		if "" == config.BearerToken && "" != a.AuthInfo.TokenFile {
+			token, err := ioutil.ReadFile(clientcmdapi.ResolvePath(a.AuthInfo.TokenFile, baseDir))
+			if nil != err {
+				return nil, err
+			}
+			config.BearerToken = strings.TrimSpace(string(token))
+		}
+		config.Username = a.AuthInfo.Username
+		config.Password = a.AuthInfo.Password
+		config.Impersonate = a.AuthInfo.Impersonate
+		config.AuthProvider = a.AuthInfo.AuthProvider
+	}
+
+	if "" != master {
+		config.Host = master
+	}
+	if "" == config.Host {
+		return nil, fmt.Errorf("no server address found for context %q", contextName)
+	}
+	glog.Infof("Using context %q of kubeconfig %s, server: %s\n", contextName, kubeconfigPath, config.Host)
+	return config, nil
+}
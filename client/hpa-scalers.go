@@ -14,6 +14,8 @@ type MemHPAScalersGetter interface {
 type MemHPAScalerInterface interface {
 	Create(scaler *v1.MemHpa) (*v1.MemHpa, error)
 	Update(scaler *v1.MemHpa) (*v1.MemHpa, error)
+	// Update status through the status subresource, changes of spec are ignored
+	UpdateStatus(scaler *v1.MemHpa) (*v1.MemHpa, error)
 	Delete(name string, options *api.DeleteOptions) error
 	Get(name string) (*v1.MemHpa, error)
 	List(opts api.ListOptions) (*v1.MemHpaList, error)
@@ -55,6 +57,19 @@ func (s *memHPAScalers) Update(scaler *v1.MemHpa) (*v1.MemHpa, error) {
 	return result, err
 }
 
+func (s *memHPAScalers) UpdateStatus(scaler *v1.MemHpa) (*v1.MemHpa, error) {
+	result := &v1.MemHpa{}
+	err := s.client.Put().
+		Namespace(s.ns).
+		Resource(v1.MemHPAResourcesName).
+		Name(scaler.MetaData.Name).
+		SubResource("status").
+		Body(scaler).
+		Do().
+		Into(result)
+	return result, err
+}
+
 func (s *memHPAScalers) Delete(name string, options *api.DeleteOptions) error {
 	return s.client.Delete().
 		Namespace(s.ns).
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/1.4/pkg/apis/autoscaling/v1"
+)
+
+// Scales of targets through the autoscaling/v1 scale subresource, e.g. of apps/v1 Deployments
+type TargetScalesGetter interface {
+	TargetScales(namespace string) TargetScaleInterface
+}
+
+type TargetScaleInterface interface {
+	Get(ref v1.CrossVersionObjectReference) (*v1.Scale, error)
+	Update(ref v1.CrossVersionObjectReference, scale *v1.Scale) (*v1.Scale, error)
+}
+
+// Group version and resource of the kinds with a scale subresource, which are used whatever apiVersion of the
+// reference is, since extensions/v1beta1 and apps/v1beta* of them are not served since K8S 1.16
+var targetResources = map[string]struct {
+	groupVersion string
+	resource string
+}{
+	"Deployment": {"apps/v1", "deployments"},
+	"ReplicaSet": {"apps/v1", "replicasets"},
+	"StatefulSet": {"apps/v1", "statefulsets"},
+	"ReplicationController": {"v1", "replicationcontrollers"},
+}
+
+type targetScales struct {
+	client *ScalingClient
+	ns string
+}
+
+func (c *ScalingClient) TargetScales(namespace string) TargetScaleInterface {
+	return &targetScales{
+		client: c,
+		ns: namespace,
+	}
+}
+
+// Return the absolute path of the group version and the resource of the target.
+// Other kinds, e.g. custom resources with a scale subresource, need apiVersion and are assumed to be
+// named by the lower case plural of kind.
+func targetResource(ref v1.CrossVersionObjectReference) (string, string, error) {
+	groupVersion, resource := ref.APIVersion, strings.ToLower(ref.Kind) + "s"
+	if known, ok := targetResources[ref.Kind]; ok {
+		groupVersion, resource = known.groupVersion, known.resource
+	} else if "" == groupVersion {
+		return "", "", fmt.Errorf("apiVersion of target kind %s is required", ref.Kind)
+	}
+	if "v1" == groupVersion {
+		return "/api/v1", resource, nil
+	}
+	return "/apis/" + groupVersion, resource, nil
+}
+
+func (s *targetScales) Get(ref v1.CrossVersionObjectReference) (*v1.Scale, error) {
+	path, resource, err := targetResource(ref)
+	if nil != err {
+		return nil, err
+	}
+	data, err := s.client.Get().
+		AbsPath(path).
+		Namespace(s.ns).
+		Resource(resource).
+		Name(ref.Name).
+		SubResource("scale").
+		DoRaw()
+	if nil != err {
+		return nil, err
+	}
+	return decodeScale(data)
+}
+
+func (s *targetScales) Update(ref v1.CrossVersionObjectReference, scale *v1.Scale) (*v1.Scale, error) {
+	path, resource, err := targetResource(ref)
+	if nil != err {
+		return nil, err
+	}
+	body, err := json.Marshal(scale)
+	if nil != err {
+		return nil, err
+	}
+	data, err := s.client.Put().
+		AbsPath(path).
+		Namespace(s.ns).
+		Resource(resource).
+		Name(ref.Name).
+		SubResource("scale").
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		DoRaw()
+	if nil != err {
+		return nil, err
+	}
+	return decodeScale(data)
+}
+
+func decodeScale(data []byte) (*v1.Scale, error) {
+	scale := &v1.Scale{}
+	if err := json.Unmarshal(data, scale); nil != err {
+		return nil, fmt.Errorf("unexpected scale: %v", err)
+	}
+	return scale, nil
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+
+	"k8s.io/client-go/1.4/pkg/apis/autoscaling/v1"
+)
+
+func TestTargetResource(t *testing.T) {
+	tests := []struct {
+		ref v1.CrossVersionObjectReference
+		expectedPath string
+		expectedResource string
+		expectedErr bool
+	}{
+		{v1.CrossVersionObjectReference{Kind: "Deployment", Name: "a"}, "/apis/apps/v1", "deployments", false},
+		{v1.CrossVersionObjectReference{Kind: "Deployment", Name: "a", APIVersion: "extensions/v1beta1"},
+			"/apis/apps/v1", "deployments", false},
+		{v1.CrossVersionObjectReference{Kind: "ReplicationController", Name: "a"}, "/api/v1",
+			"replicationcontrollers", false},
+		{v1.CrossVersionObjectReference{Kind: "Rollout", Name: "a", APIVersion: "argoproj.io/v1alpha1"},
+			"/apis/argoproj.io/v1alpha1", "rollouts", false},
+		{v1.CrossVersionObjectReference{Kind: "Rollout", Name: "a"}, "", "", true},
+	}
+	for _, test := range tests {
+		path, resource, err := targetResource(test.ref)
+		if test.expectedErr != (nil != err) {
+			t.Errorf("%s: expected error %v, got %v", test.ref.Kind, test.expectedErr, err)
+			continue
+		}
+		if test.expectedPath != path || test.expectedResource != resource {
+			t.Errorf("%s %s: expected %s %s, got %s %s", test.ref.APIVersion, test.ref.Kind, test.expectedPath,
+				test.expectedResource, path, resource)
+		}
+	}
+}
@@ -4,36 +4,38 @@ import (
 	"time"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"sync"
 
 	"memhpa/client"
 	memhpav1 "memhpa/apis/v1"
 	"memhpa/controller/informer"
+	"memhpa/controller/metrics"
+	"memhpa/controller/workqueue"
+	"memhpa/monitoring"
 
-	"k8s.io/client-go/1.4/kubernetes/typed/extensions/v1beta1"
 	"k8s.io/client-go/1.4/tools/record"
 	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
 	apiv1 "k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/api/resource"
 	"k8s.io/client-go/1.4/pkg/api"
+	"k8s.io/client-go/1.4/pkg/api/errors"
 	"k8s.io/client-go/1.4/tools/cache"
 	"k8s.io/client-go/1.4/pkg/runtime"
 	"k8s.io/client-go/1.4/pkg/watch"
-	apisv1beta1 "k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+	autoscalingv1 "k8s.io/client-go/1.4/pkg/apis/autoscaling/v1"
+	"k8s.io/client-go/1.4/pkg/labels"
 	"k8s.io/client-go/1.4/pkg/api/unversioned"
 	utilruntime "k8s.io/client-go/1.4/pkg/util/runtime"
+	"k8s.io/client-go/1.4/pkg/util/validation/field"
 
 	"github.com/golang/glog"
-)
-
-const (
-	scaleUpLimitMinimum = 4
-	scaleUpLimitFactor = 2
-
-        upscaleForbiddenWindow = 3 * time.Minute
-	downscaleForbiddenWindow = 5 * time.Minute
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type HPAController struct {
-	scaleNamespacer v1beta1.ScalesGetter
+	scaleNamespacer client.TargetScalesGetter
 	hpaNamespacer   client.MemHPAScalersGetter
 
 	replicaCalc   *ReplicaCalculator
@@ -43,11 +45,48 @@ type HPAController struct {
 	store cache.Store
 	// Watches changes to all HPA objects.
 	informer *informer.Informer
+	// Keys (namespace/name) of HPA objects to reconcile
+	queue workqueue.RateLimitingInterface
+
+	// Recent scale events of each HPA keyed by namespace/name, counted against policies of behavior
+	scaleEvents map[string][]scaleEvent
+	scaleEventsLock sync.Mutex
+	// Recent recommendations of each HPA keyed by namespace/name, to stabilize scaling down
+	recommendations map[string]*recommendationBuffer
+	recommendationsLock sync.Mutex
+	// Times when each HPA keyed by namespace/name is requeued at, e.g. the next boundary of its schedules
+	requeues map[string]time.Time
+	requeuesLock sync.Mutex
+
+	resyncPeriod time.Duration
+	// Don't scale any target, as if mode of all HPAs were RecommendOnly
+	dryRun bool
+	// Times of running, the last finished reconcile and the last metrics fetches, for health checks
+	startTime time.Time
+	lastReconcileTime time.Time
+	lastMetricsSuccessTime time.Time
+	lastMetricsFailureTime time.Time
+	healthLock sync.Mutex
+}
+
+const (
+	// Max times to write a MemHpa on conflicts
+	maxUpdateRetries = 5
+
+	// Backoff of reconciling a MemHpa after failures
+	failureBaseDelay = time.Second
+	failureMaxDelay = 5 * time.Minute
+)
+
+type scaleEvent struct {
+	// positive for scaling up and negative for scaling down
+	replicaChange int32
+	timestamp time.Time
 }
 
-func NewHPAController(evtNamespacer v1.EventsGetter, scaleNamespacer v1beta1.ScalesGetter,
+func NewHPAController(evtNamespacer v1.EventsGetter, scaleNamespacer client.TargetScalesGetter,
 	hpaNamespacer client.MemHPAScalersGetter, replicaCalc *ReplicaCalculator,
-	resyncPeriod time.Duration) *HPAController {
+	resyncPeriod time.Duration, dryRun bool) *HPAController {
 
 	broadcaster := record.NewBroadcaster()
 	broadcaster.StartRecordingToSink(&v1.EventSinkImpl{Interface:evtNamespacer.Events("")})
@@ -58,6 +97,12 @@ func NewHPAController(evtNamespacer v1.EventsGetter, scaleNamespacer v1beta1.Sca
 		hpaNamespacer: hpaNamespacer,
 		replicaCalc: replicaCalc,
 		eventRecorder: broadcaster.NewRecorder(apiv1.EventSource{Component:"custom-mem-hpa-controller"}),
+		scaleEvents: make(map[string][]scaleEvent),
+		recommendations: make(map[string]*recommendationBuffer),
+		requeues: make(map[string]time.Time),
+		queue: workqueue.NewRateLimitingQueue(failureBaseDelay, failureMaxDelay),
+		resyncPeriod: resyncPeriod,
+		dryRun: dryRun,
 	}
 
 	hpaController.newInformer(resyncPeriod)
@@ -65,12 +110,96 @@ func NewHPAController(evtNamespacer v1.EventsGetter, scaleNamespacer v1beta1.Sca
 	return hpaController
 }
 
-func (controller *HPAController) Run(stopCh <-chan struct{}) {
+// Run the controller with the number of workers reconciling HPAs concurrently until stopCh is closed.
+// Then wait for in-flight reconciles to finish, but not longer than shutdownTimeout.
+func (controller *HPAController) Run(workers int, shutdownTimeout time.Duration, stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
-	glog.Infof("Starting HPA Controller")
+	glog.Infof("Starting HPA Controller with %d workers", workers)
+	controller.healthLock.Lock()
+	controller.startTime = time.Now()
+	controller.healthLock.Unlock()
 	go controller.informer.Run(stopCh)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			controller.worker()
+		}()
+	}
 	<-stopCh
+
 	glog.Infof("Shutting down HPA Controller")
+	controller.queue.ShutDown()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		glog.Infof("HPA Controller stopped")
+	case <-time.After(shutdownTimeout):
+		glog.Warningf("Timed out waiting for in-flight reconciles after %v\n", shutdownTimeout)
+	}
+}
+
+func (controller *HPAController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if nil != err {
+		glog.Errorf("Failed to get key of mem hpa: %#v\n", err)
+		return
+	}
+	controller.queue.Add(key)
+}
+
+// Process keys of the queue until it is shut down
+func (controller *HPAController) worker() {
+	for controller.processNextKey() {
+	}
+}
+
+func (controller *HPAController) processNextKey() bool {
+	key, shutdown := controller.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer controller.queue.Done(key)
+	if controller.queue.ShuttingDown() {
+		// don't start reconciling waiting keys after stop
+		return false
+	}
+
+	obj, exists, err := controller.store.GetByKey(key)
+	if nil != err {
+		glog.Errorf("Failed to get mem hpa %s from store: %#v\n", key, err)
+		controller.queue.AddRateLimited(key)
+		return true
+	}
+	if !exists {
+		// deleted, e.g. while a requeue of it was pending. The state kept of it is forgotten again, since a
+		// reconcile in flight when it was deleted may have kept some.
+		controller.forget(key)
+		return true
+	}
+
+	hpa := obj.(*memhpav1.MemHpa)
+	start := time.Now()
+	err = controller.reconcile(hpa)
+	monitoring.ObserveReconcile(hpa.MetaData.Namespace, hpa.MetaData.Name, start)
+	controller.recordReconcile()
+	if isMemHPANotFound(err) {
+		glog.V(2).Infof("Mem hpa %s was deleted while reconciling\n", key)
+		controller.forget(key)
+		return true
+	}
+	if nil != err {
+		glog.V(2).Infof("Requeue mem hpa %s after %d failures: %v\n", key, controller.queue.NumRequeues(key) + 1, err)
+		controller.queue.AddRateLimited(key)
+		return true
+	}
+	controller.queue.Forget(key)
+	return true
 }
 
 func (controller *HPAController) newInformer(resyncPeriod time.Duration) {
@@ -86,33 +215,73 @@ func (controller *HPAController) newInformer(resyncPeriod time.Duration) {
 		&memhpav1.MemHpa{},
 		resyncPeriod,
 		informer.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				hpa := obj.(*memhpav1.MemHpa)
-				controller.reconcile(hpa)
-			},
+			AddFunc: controller.enqueue,
 			UpdateFunc: func(oldObj, newObj interface{}) {
-				hpa := newObj.(*memhpav1.MemHpa)
-				controller.reconcile(hpa)
+				controller.enqueue(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				key, err := informer.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if nil != err {
+					glog.Errorf("Failed to get key of deleted mem hpa: %#v\n", err)
+					return
+				}
+				controller.forget(key)
+				glog.Infof("Mem hpa %s was deleted\n", key)
 			},
 		},
 	)
 }
 
-func (controller *HPAController) reconcile(hpa *memhpav1.MemHpa) {
-	modified := controller.validate(hpa)
+// Reconcile the HPA, return an error if it should be retried
+func (controller *HPAController) reconcile(cached *memhpav1.MemHpa) error {
+	// work on a copy, the cached object must not be modified
+	obj, err := api.Scheme.DeepCopy(cached)
+	if nil != err {
+		glog.Errorf("Failed to copy mem hpa %s: %#v\n", hpaKey(cached), err)
+		return err
+	}
+	hpa := obj.(*memhpav1.MemHpa)
+	if deleting, err := controller.handleFinalizer(hpa); deleting || nil != err {
+		return err
+	}
+	hpa = controller.applyDefaults(hpa)
+	controller.validate(hpa)
+
+	// override min and max replicas with the active schedule, and reconcile again once it changes
+	schedule, boundary := activeSchedule(hpa.Spec.Schedules, time.Now())
+	activeScheduleName := ""
+	if nil != schedule {
+		activeScheduleName = schedule.Name
+		applySchedule(hpa, schedule)
+	}
+	if activeScheduleName != hpa.Status.ActiveSchedule {
+		if "" != activeScheduleName {
+			controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "ScheduleActivated",
+				"Schedule %s is active, min replicas: %d, max replicas: %d", activeScheduleName,
+				*hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+		} else {
+			controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "ScheduleEnded",
+				"Schedule %s is not active any more", hpa.Status.ActiveSchedule)
+		}
+	}
+	if !boundary.IsZero() {
+		controller.requeueAt(hpaKey(hpa), boundary)
+	}
 	reference := fmt.Sprintf("%s/%s(%s)", hpa.Spec.ScaleTargetRef.Name, hpa.MetaData.Namespace,
 		hpa.Spec.ScaleTargetRef.Kind)
 
 	// get scale subresource
-	scale, err := controller.scaleNamespacer.Scales(hpa.MetaData.Namespace).Get(hpa.Spec.ScaleTargetRef.Kind,
-		hpa.Spec.ScaleTargetRef.Name)
+	scale, err := controller.scaleNamespacer.TargetScales(hpa.MetaData.Namespace).Get(hpa.Spec.ScaleTargetRef)
 	if nil != err {
-		// if validate() modified the hpa, the resource should be updated
-		if modified {
-			controller.update(hpa)
-		}
+		controller.eventRecorder.Event(hpa, api.EventTypeWarning, "FailedGetScale", err.Error())
+		status := hpa.Status
+		status.Conditions = copyConditions(hpa.Status.Conditions)
+		status.ActiveSchedule = activeScheduleName
+		setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionFalse, "FailedGetScale",
+			"the HPA controller was unable to get the target's current scale: %v", err)
+		controller.updateStatus(hpa, status, false)
 		glog.Errorf("Failed to get scale subresource of %s: %v\n", reference, err)
-		return
+		return err
 	}
 
 	currentReplicas := scale.Status.Replicas
@@ -120,60 +289,196 @@ func (controller *HPAController) reconcile(hpa *memhpav1.MemHpa) {
 	rescale := true
 	rescaleReason := ""
 	timestamp := time.Now()
-	utilization := int32(0)
+	status := memhpav1.MemHPAScalerStatus{
+		CurrentReplicas: currentReplicas,
+		MemorySignal: controller.replicaCalc.MemorySignal(hpa.Spec.MemorySignal),
+		Conditions: copyConditions(hpa.Status.Conditions),
+		ActiveSchedule: activeScheduleName,
+	}
+	setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionTrue, "SucceededGetScale",
+		"the HPA controller was able to get the target's current scale")
+
+	mode := controller.scalingMode(hpa)
+	status.Mode = mode
+	if memhpav1.OffScalingMode == mode {
+		setCondition(&status, memhpav1.ScalingActive, apiv1.ConditionFalse, "ScalingOff",
+			"scaling is turned off by .spec.mode")
+		status.DesiredReplicas = currentReplicas
+		return controller.updateStatus(hpa, status, false)
+	}
 
-	if 0 == scale.Spec.Replicas {
+	if 0 == scale.Spec.Replicas && nil == hpa.Spec.ScaleToZero {
 		rescale = false
+		setCondition(&status, memhpav1.ScalingActive, apiv1.ConditionFalse, "ScalingDisabled",
+			"scaling is disabled since the replica count of the target is zero")
+	} else if 0 == scale.Spec.Replicas && 0 == *hpa.Spec.MinReplicas {
+		// wake the target up on demand, metrics of pods are not available at zero
+		wake, err := controller.shouldWake(hpa)
+		if nil != err {
+			controller.eventRecorder.Event(hpa, api.EventTypeWarning, "FailedGetWakeMetric", err.Error())
+			monitoring.MetricFetchErrors.WithLabelValues(hpa.MetaData.Namespace, hpa.MetaData.Name,
+			"FailedGetWakeMetric").Inc()
+			setCondition(&status, memhpav1.ScalingActive, apiv1.ConditionFalse, "FailedGetWakeMetric",
+				"the HPA controller was unable to evaluate the wake query: %v", err)
+			status.IdleSince = hpa.Status.IdleSince
+			controller.updateStatus(hpa, status, false)
+			glog.Errorf("Failed to evaluate wake query of %s: %v\n", reference, err)
+			return err
+		}
+		if wake {
+			desiredReplicas = hpa.Spec.ScaleToZero.GetWakeReplicas()
+			if desiredReplicas > hpa.Spec.MaxReplicas {
+				desiredReplicas = hpa.Spec.MaxReplicas
+			}
+			rescaleReason = "Wake query is positive"
+			setCondition(&status, memhpav1.ScalingActive, apiv1.ConditionTrue, "WakeUp",
+				"the target is woken up since the wake query is positive")
+		} else {
+			rescale = false
+			status.IdleSince = hpa.Status.IdleSince
+			setCondition(&status, memhpav1.ScalingActive, apiv1.ConditionFalse, "ScaledToZero",
+				"the target is scaled to zero until the wake query is positive")
+		}
 	} else if currentReplicas > hpa.Spec.MaxReplicas {
 		desiredReplicas = hpa.Spec.MaxReplicas
 		rescaleReason = "Current number is greater than .spec.maxReplicas"
+		setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionTrue, "TooManyReplicas",
+			"the desired replica count is more than the maximum replica count")
 	} else if currentReplicas < *hpa.Spec.MinReplicas {
 		desiredReplicas = *hpa.Spec.MinReplicas
 		rescaleReason = "Current number is less than .spec.minReplicas"
+		setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionTrue, "TooFewReplicas",
+			"the desired replica count is less than the minimum replica count")
 	} else {
 		// calculate desired replicas
-		desiredReplicas, utilization, timestamp, err = controller.computeReplicas(hpa, scale)
+		var metric memhpav1.MetricSourceType
+		desiredReplicas, metric, timestamp, err = controller.computeReplicas(hpa, scale, &status)
 		if nil != err {
-			controller.updateStatus(hpa, currentReplicas, hpa.Status.DesiredReplicas,
-				hpa.Status.CurrentUtilizationPercentage, false)
+			// keep the last observed metrics, computeReplicas() has set the conditions
+			conditions := status.Conditions
+			status = hpa.Status
+			status.CurrentReplicas = currentReplicas
+			status.Conditions = conditions
+			status.ActiveSchedule = activeScheduleName
+			controller.updateStatus(hpa, status, false)
 			glog.Errorf("Failed to calculate desired replicas of %s: %v\n", reference, err)
-			return
+			return err
 		}
 
 		if desiredReplicas > currentReplicas {
-			rescaleReason = "Utilization is greater than target"
+			rescaleReason = fmt.Sprintf("%s metric is greater than target", metric)
 		} else if desiredReplicas < currentReplicas {
-			rescaleReason = "Utilization is less than target"
+			rescaleReason = fmt.Sprintf("%s metric is less than target", metric)
 		}
 
-		if desiredReplicas < *hpa.Spec.MinReplicas {
-			desiredReplicas = *hpa.Spec.MinReplicas
+		limited := false
+		// metrics never scale to zero, only the idle rule of scaleToZero does
+		minReplicas := *hpa.Spec.MinReplicas
+		if minReplicas < 1 {
+			minReplicas = 1
+		}
+		if desiredReplicas < minReplicas {
+			desiredReplicas = minReplicas
+			limited = true
+			setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionTrue, "TooFewReplicas",
+				"the desired replica count is less than the minimum replica count")
 		}
 		if desiredReplicas > hpa.Spec.MaxReplicas {
 			desiredReplicas = hpa.Spec.MaxReplicas
+			limited = true
+			setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionTrue, "TooManyReplicas",
+				"the desired replica count is more than the maximum replica count")
+		}
+		// scale down only to the max recommendation in the stabilization window
+		var stabilized bool
+		desiredReplicas, stabilized = controller.stabilizeScaleDown(hpa, currentReplicas, desiredReplicas)
+
+		// limit the rate of scaling according to policies of behavior
+		events := controller.getScaleEvents(hpa)
+		if desiredReplicas > currentReplicas {
+			scaleUpLimit := getScaleUpLimit(currentReplicas, hpa.Spec.GetScaleUpRules(),
+				hpa.Spec.GetScaleUpLimitMinimum(), events, time.Now())
+			if desiredReplicas > scaleUpLimit {
+				desiredReplicas = scaleUpLimit
+				limited = true
+				setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionTrue, "ScaleUpLimit",
+					"the desired replica count is increasing faster than the scale up policies allow")
+			}
+		} else if desiredReplicas < currentReplicas {
+			scaleDownLimit := getScaleDownLimit(currentReplicas, hpa.Spec.GetScaleDownRules(), events, time.Now())
+			if desiredReplicas < scaleDownLimit {
+				desiredReplicas = scaleDownLimit
+				limited = true
+				setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionTrue, "ScaleDownLimit",
+					"the desired replica count is decreasing faster than the scale down policies allow")
+			}
 		}
-		scaleUpLimit := getScaleUpLimit(currentReplicas)
-		if desiredReplicas > scaleUpLimit {
-			desiredReplicas = scaleUpLimit
+		if !limited {
+			setCondition(&status, memhpav1.ScalingLimited, apiv1.ConditionFalse, "DesiredWithinRange",
+				"the desired count is within the acceptable range")
 		}
 
 		// check whether it should be scaled
-		rescale = shouldScale(hpa, currentReplicas, desiredReplicas, timestamp)
+		rescale = shouldScale(hpa, currentReplicas, desiredReplicas, timestamp, stabilized)
+		if !rescale && desiredReplicas != currentReplicas {
+			if desiredReplicas > currentReplicas {
+				setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionFalse, "BackoffUpscale",
+					"the time since the previous scale is still within the scale up stabilization window")
+			} else {
+				setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionFalse, "BackoffDownscale",
+					"the time since the previous scale is still within the scale down stabilization window")
+			}
+		}
+
+		if nil != hpa.Spec.ScaleToZero && 0 == *hpa.Spec.MinReplicas {
+			idle, err := controller.checkIdle(hpa, scale, &status, time.Now())
+			if nil != err {
+				controller.eventRecorder.Event(hpa, api.EventTypeWarning, "FailedCheckIdle", err.Error())
+				glog.Errorf("Failed to check whether %s is idle: %v\n", reference, err)
+			} else if idle {
+				desiredReplicas = 0
+				rescale = true
+				rescaleReason = fmt.Sprintf("Memory is below %s for %s", hpa.Spec.ScaleToZero.IdleBelow.String(),
+					hpa.Spec.ScaleToZero.IdleDuration)
+			}
+		}
+	}
+
+	if rescale {
+		status.Reason = rescaleReason
+	}
+	if rescale && memhpav1.RecommendOnlyScalingMode == mode {
+		// publish the recommendation without scaling
+		controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "RecommendedRescale",
+			"New size: %d; reason: %s; not applied in RecommendOnly mode", desiredReplicas, rescaleReason)
+		setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionTrue, "RecommendOnly",
+			"the HPA controller recommends %d replicas, but doesn't scale in RecommendOnly mode", desiredReplicas)
+		glog.Infof("Recommended rescale of %s, current size: %d, recommended size: %d, reason: %s\n",
+			hpa.MetaData.Name, currentReplicas, desiredReplicas, rescaleReason)
+		status.DesiredReplicas = desiredReplicas
+		return controller.updateStatus(hpa, status, false)
 	}
 
 	if rescale {
 		// update scale subresource to scale
 		scale.Spec.Replicas = desiredReplicas
-		if _, err := controller.scaleNamespacer.Scales(hpa.MetaData.Namespace).
-			Update(hpa.Spec.ScaleTargetRef.Kind, scale); nil != err {
+		if _, err := controller.scaleNamespacer.TargetScales(hpa.MetaData.Namespace).
+			Update(hpa.Spec.ScaleTargetRef, scale); nil != err {
 
 			controller.eventRecorder.Eventf(hpa, api.EventTypeWarning, "FailedRescale",
 				"New size: %d; reason: %s; error: %v", desiredReplicas, rescaleReason, err)
+			setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionFalse, "FailedUpdateScale",
+				"the HPA controller was unable to update the target scale: %v", err)
+			status.DesiredReplicas = currentReplicas
+			controller.updateStatus(hpa, status, false)
 			glog.Errorf("Failed to scale: %v\n", err)
-			return
+			return err
 		}
 		controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "SuccessfulRescale", "" +
 			"New size: %d; reason: %s", desiredReplicas, rescaleReason)
+		setCondition(&status, memhpav1.AbleToScale, apiv1.ConditionTrue, "SucceededRescale",
+			"the HPA controller was able to update the target scale to %d", desiredReplicas)
+		controller.recordScaleEvent(hpa, desiredReplicas - currentReplicas)
 		glog.Infof("Successfull rescale of %s, old size: %d, new size: %d, reason: %s",
 			hpa.MetaData.Name, currentReplicas, desiredReplicas, rescaleReason)
 	} else {
@@ -181,23 +486,31 @@ func (controller *HPAController) reconcile(hpa *memhpav1.MemHpa) {
 	}
 
 	// update mem hpa
-	controller.updateStatus(hpa, currentReplicas, desiredReplicas, utilization, rescale)
+	status.DesiredReplicas = desiredReplicas
+	return controller.updateStatus(hpa, status, rescale)
 }
 
-func shouldScale(hpa *memhpav1.MemHpa, current, desired int32, timestamp time.Time) bool {
+// Return whether it should be scaled from current to desired replicas. If downscaleStabilized is true,
+// scaling down was already stabilized by recommendations, otherwise it is not allowed within the
+// stabilization window since the last scale.
+func shouldScale(hpa *memhpav1.MemHpa, current, desired int32, timestamp time.Time,
+	downscaleStabilized bool) bool {
+
 	if desired == current {
 		return false
 	}
 
-	if hpa.Status.LastScaleTime == nil {
+	if hpa.Status.LastScaleTime == nil || (desired < current && downscaleStabilized) {
 		return true
 	}
 
-	// Do not rescale too often
-	if desired < current && hpa.Status.LastScaleTime.Time.Add(downscaleForbiddenWindow).Before(timestamp) {
+	// Do not rescale within the stabilization window of the direction
+	if desired < current && hpa.Status.LastScaleTime.Time.Add(
+		stabilizationWindow(hpa.Spec.GetScaleDownRules())).Before(timestamp) {
 		return true
 	}
-	if desired > current && hpa.Status.LastScaleTime.Time.Add(upscaleForbiddenWindow).Before(timestamp) {
+	if desired > current && hpa.Status.LastScaleTime.Time.Add(
+		stabilizationWindow(hpa.Spec.GetScaleUpRules())).Before(timestamp) {
 		return true
 	}
 
@@ -207,25 +520,413 @@ func shouldScale(hpa *memhpav1.MemHpa, current, desired int32, timestamp time.Ti
 	return false
 }
 
-func getScaleUpLimit(currentReplicas int32) int32 {
-	return int32(math.Max(scaleUpLimitFactor * float64(currentReplicas), scaleUpLimitMinimum))
+func stabilizationWindow(rules memhpav1.HPAScalingRules) time.Duration {
+	return time.Duration(*rules.StabilizationWindowSeconds) * time.Second
+}
+
+// Return the max replicas allowed by the scale up rules, it is not less than current replicas nor minimum
+// unless scaling up is disabled
+func getScaleUpLimit(currentReplicas int32, rules memhpav1.HPAScalingRules, minimum int32, events []scaleEvent,
+	now time.Time) int32 {
+
+	if memhpav1.DisabledPolicySelect == rules.SelectPolicy {
+		return currentReplicas
+	}
+	var limit int32
+	for i, p := range rules.Policies {
+		added, _ := replicasChangedInPeriod(events, p.PeriodSeconds, now)
+		periodStartReplicas := currentReplicas - added
+		var proposed int32
+		if memhpav1.PodsScalingPolicy == p.Type {
+			proposed = periodStartReplicas + p.Value
+		} else {
+			proposed = int32(math.Ceil(float64(periodStartReplicas) * (1 + float64(p.Value) / 100)))
+		}
+		selectMax := memhpav1.MinPolicySelect != rules.SelectPolicy
+		if 0 == i || (selectMax && proposed > limit) || (!selectMax && proposed < limit) {
+			limit = proposed
+		}
+	}
+	if limit < minimum {
+		limit = minimum
+	}
+	if limit < currentReplicas {
+		limit = currentReplicas
+	}
+	return limit
+}
+
+// Return the min replicas allowed by the scale down rules, it is not greater than current replicas
+func getScaleDownLimit(currentReplicas int32, rules memhpav1.HPAScalingRules, events []scaleEvent,
+	now time.Time) int32 {
+
+	if memhpav1.DisabledPolicySelect == rules.SelectPolicy {
+		return currentReplicas
+	}
+	var limit int32
+	for i, p := range rules.Policies {
+		_, removed := replicasChangedInPeriod(events, p.PeriodSeconds, now)
+		periodStartReplicas := currentReplicas + removed
+		var proposed int32
+		if memhpav1.PodsScalingPolicy == p.Type {
+			proposed = periodStartReplicas - p.Value
+		} else {
+			proposed = int32(float64(periodStartReplicas) * (1 - float64(p.Value) / 100))
+		}
+		// Max selects the policy allowing the largest change, that is the fewest replicas
+		selectMax := memhpav1.MinPolicySelect != rules.SelectPolicy
+		if 0 == i || (selectMax && proposed < limit) || (!selectMax && proposed > limit) {
+			limit = proposed
+		}
+	}
+	if limit > currentReplicas {
+		limit = currentReplicas
+	}
+	return limit
+}
+
+// Return replicas added and removed in the period before now
+func replicasChangedInPeriod(events []scaleEvent, periodSeconds int32, now time.Time) (int32, int32) {
+	periodStart := now.Add(-time.Duration(periodSeconds) * time.Second)
+	var added, removed int32
+	for _, e := range events {
+		if e.timestamp.Before(periodStart) {
+			continue
+		}
+		if e.replicaChange > 0 {
+			added += e.replicaChange
+		} else {
+			removed -= e.replicaChange
+		}
+	}
+	return added, removed
+}
+
+// Record the recommendation of the HPA. If it is a scale down, return the max recommendation in the
+// scale down stabilization window (but not more than current replicas) and whether the recommendations
+// cover the whole window. Otherwise return the recommendation and false.
+func (controller *HPAController) stabilizeScaleDown(hpa *memhpav1.MemHpa, currentReplicas,
+	recommendation int32) (int32, bool) {
+
+	now := time.Now()
+	controller.recommendationsLock.Lock()
+	defer controller.recommendationsLock.Unlock()
+	key := hpaKey(hpa)
+	buffer, found := controller.recommendations[key]
+	if !found {
+		buffer = newRecommendationBuffer(maxRecommendations)
+		controller.recommendations[key] = buffer
+	}
+	buffer.add(recommendation, now)
+	if recommendation >= currentReplicas {
+		return recommendation, false
+	}
+
+	max, covered := buffer.maxSince(now.Add(-stabilizationWindow(hpa.Spec.GetScaleDownRules())))
+	if max > currentReplicas {
+		max = currentReplicas
+	}
+	if glog.V(2) && max != recommendation {
+		glog.Infof("Stabilized recommendation of %s from %d to %d\n", key, recommendation, max)
+	}
+	return max, covered
+}
+
+// Drop state and queued work of the deleted HPA
+func (controller *HPAController) forget(key string) {
+	controller.queue.Forget(key)
+
+	controller.requeuesLock.Lock()
+	delete(controller.requeues, key)
+	controller.requeuesLock.Unlock()
+
+	controller.recommendationsLock.Lock()
+	delete(controller.recommendations, key)
+	controller.recommendationsLock.Unlock()
+
+	controller.scaleEventsLock.Lock()
+	delete(controller.scaleEvents, key)
+	controller.scaleEventsLock.Unlock()
+
+	if namespace, name, err := cache.SplitMetaNamespaceKey(key); nil == err {
+		monitoring.DeleteMemHpa(namespace, name)
+	}
+}
+
+// Add or remove the finalizer according to .spec.replicasOnDelete. If the HPA is being deleted, restore
+// replicas of the target and remove the finalizer, then return true since the HPA should not be reconciled.
+func (controller *HPAController) handleFinalizer(hpa *memhpav1.MemHpa) (bool, error) {
+	found := hasFinalizer(hpa)
+	if nil == hpa.MetaData.DeletionTimestamp {
+		if found == (nil != hpa.Spec.ReplicasOnDelete) {
+			return false, nil
+		}
+		return false, controller.updateFinalizer(hpa, !found)
+	}
+	if !found {
+		return true, nil
+	}
+
+	if nil != hpa.Spec.ReplicasOnDelete {
+		if memhpav1.AutoScalingMode != controller.scalingMode(hpa) {
+			controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "SkippedRestoreReplicas",
+				"Replicas are not restored to %d in %s mode", *hpa.Spec.ReplicasOnDelete, controller.scalingMode(hpa))
+		} else if err := controller.restoreReplicas(hpa, *hpa.Spec.ReplicasOnDelete); nil != err {
+			return true, err
+		}
+	}
+	return true, controller.updateFinalizer(hpa, false)
+}
+
+// Scale the target of the deleted HPA to replicas, it is done if the target doesn't exist
+func (controller *HPAController) restoreReplicas(hpa *memhpav1.MemHpa, replicas int32) error {
+	scales := controller.scaleNamespacer.TargetScales(hpa.MetaData.Namespace)
+	scale, err := scales.Get(hpa.Spec.ScaleTargetRef)
+	if nil != err {
+		if errors.IsNotFound(err) {
+			glog.V(2).Infof("Target of deleted mem hpa %s doesn't exist\n", hpaKey(hpa))
+			return nil
+		}
+		glog.Errorf("Failed to get scale subresource of deleted mem hpa %s: %v\n", hpaKey(hpa), err)
+		return err
+	}
+	if replicas == scale.Spec.Replicas {
+		return nil
+	}
+
+	oldReplicas := scale.Spec.Replicas
+	scale.Spec.Replicas = replicas
+	if _, err := scales.Update(hpa.Spec.ScaleTargetRef, scale); nil != err {
+		controller.eventRecorder.Eventf(hpa, api.EventTypeWarning, "FailedRestoreReplicas",
+			"New size: %d; error: %v", replicas, err)
+		glog.Errorf("Failed to restore replicas of deleted mem hpa %s: %v\n", hpaKey(hpa), err)
+		return err
+	}
+	controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "SuccessfulRestoreReplicas",
+		"New size: %d; reason: mem hpa was deleted", replicas)
+	glog.Infof("Restored replicas of %s since mem hpa was deleted, old size: %d, new size: %d\n",
+		hpaKey(hpa), oldReplicas, replicas)
+	return nil
+}
+
+// Add or remove the finalizer of the HPA with conflict retry, hpa is updated to the written object
+func (controller *HPAController) updateFinalizer(hpa *memhpav1.MemHpa, add bool) error {
+	scalers := controller.hpaNamespacer.Scalers(hpa.MetaData.Namespace)
+	latest := hpa
+	for i := 0; ; i++ {
+		if add {
+			latest.MetaData.Finalizers = append(latest.MetaData.Finalizers, memhpav1.RestoreReplicasFinalizer)
+		} else {
+			finalizers := []string{}
+			for _, f := range latest.MetaData.Finalizers {
+				if memhpav1.RestoreReplicasFinalizer != f {
+					finalizers = append(finalizers, f)
+				}
+			}
+			latest.MetaData.Finalizers = finalizers
+		}
+		updated, err := scalers.Update(latest)
+		if nil == err {
+			*hpa = *updated
+			glog.V(2).Infof("Successfully updated finalizers of %s\n", hpaKey(hpa))
+			return nil
+		}
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if !errors.IsConflict(err) || i >= maxUpdateRetries - 1 {
+			glog.Errorf("Failed to update finalizers of mem hpa %s: %#v\n", hpaKey(hpa), err)
+			return err
+		}
+		if latest, err = scalers.Get(hpa.MetaData.Name); nil != err {
+			glog.Errorf("Failed to get mem hpa %s: %#v\n", hpaKey(hpa), err)
+			return err
+		}
+		if add == hasFinalizer(latest) {
+			*hpa = *latest
+			return nil
+		}
+	}
+}
+
+// Return the mode in effect, RecommendOnly if the controller runs in dry run unless the HPA is Off
+func (controller *HPAController) scalingMode(hpa *memhpav1.MemHpa) memhpav1.ScalingMode {
+	mode := hpa.Spec.Mode
+	if "" == mode {
+		mode = memhpav1.AutoScalingMode
+	}
+	if controller.dryRun && memhpav1.OffScalingMode != mode {
+		return memhpav1.RecommendOnlyScalingMode
+	}
+	return mode
+}
+
+func hasFinalizer(hpa *memhpav1.MemHpa) bool {
+	for _, f := range hpa.MetaData.Finalizers {
+		if memhpav1.RestoreReplicasFinalizer == f {
+			return true
+		}
+	}
+	return false
+}
+
+func hpaKey(hpa *memhpav1.MemHpa) string {
+	return hpa.MetaData.Namespace + "/" + hpa.MetaData.Name
 }
 
-func (controller *HPAController) update(hpa *memhpav1.MemHpa) {
-	if _, err := controller.hpaNamespacer.Scalers(hpa.MetaData.Namespace).Update(hpa); nil != err {
-		glog.Errorf("Failed to update mem hpa: %#v\n", err)
+func (controller *HPAController) getScaleEvents(hpa *memhpav1.MemHpa) []scaleEvent {
+	controller.scaleEventsLock.Lock()
+	defer controller.scaleEventsLock.Unlock()
+	return controller.scaleEvents[hpaKey(hpa)]
+}
+
+// Record a scale event of the HPA and drop events older than the longest period of its policies
+func (controller *HPAController) recordScaleEvent(hpa *memhpav1.MemHpa, replicaChange int32) {
+	var longestPeriod int32
+	for _, rules := range []memhpav1.HPAScalingRules{hpa.Spec.GetScaleUpRules(), hpa.Spec.GetScaleDownRules()} {
+		for _, p := range rules.Policies {
+			if p.PeriodSeconds > longestPeriod {
+				longestPeriod = p.PeriodSeconds
+			}
+		}
+	}
+	now := time.Now()
+	expired := now.Add(-time.Duration(longestPeriod) * time.Second)
+
+	controller.scaleEventsLock.Lock()
+	defer controller.scaleEventsLock.Unlock()
+	key := hpaKey(hpa)
+	events := make([]scaleEvent, 0, len(controller.scaleEvents[key]) + 1)
+	for _, e := range controller.scaleEvents[key] {
+		if !e.timestamp.Before(expired) {
+			events = append(events, e)
+		}
+	}
+	controller.scaleEvents[key] = append(events, scaleEvent{replicaChange: replicaChange, timestamp: now})
+
+	direction := monitoring.ScaleUp
+	if replicaChange < 0 {
+		direction = monitoring.ScaleDown
+	}
+	monitoring.ScaleEvents.WithLabelValues(hpa.MetaData.Namespace, hpa.MetaData.Name, direction).Inc()
+}
+
+// Set defaults of the unset fields of spec and write them, so that users can see the values in use.
+// It is the only case that spec is written by the controller. Invalid values are corrected by validate() in memory.
+// Return the written or latest object to continue with, so that the following writes of status don't conflict,
+// or hpa with defaults set in memory if writing fails.
+func (controller *HPAController) applyDefaults(hpa *memhpav1.MemHpa) *memhpav1.MemHpa {
+	spec := hpa.Spec
+	memhpav1.SetDefaults(hpa)
+	if api.Semantic.DeepEqual(spec, hpa.Spec) {
+		return hpa
+	}
+
+	scalers := controller.hpaNamespacer.Scalers(hpa.MetaData.Namespace)
+	latest := hpa
+	for i := 0; ; i++ {
+		updated, err := scalers.Update(latest)
+		if nil == err {
+			glog.V(2).Infof("Successfully set defaults of %s\n", hpaKey(hpa))
+			return updated
+		}
+		if !errors.IsConflict(err) || i >= maxUpdateRetries - 1 {
+			glog.Errorf("Failed to set defaults of mem hpa %s: %#v\n", hpaKey(hpa), err)
+			return hpa
+		}
+		// set defaults of the latest spec, the changes of users are kept
+		if latest, err = scalers.Get(hpa.MetaData.Name); nil != err {
+			glog.Errorf("Failed to get mem hpa %s: %#v\n", hpaKey(hpa), err)
+			return hpa
+		}
+		spec := latest.Spec
+		memhpav1.SetDefaults(latest)
+		if api.Semantic.DeepEqual(spec, latest.Spec) {
+			return latest
+		}
+	}
+}
+
+// Return whether err is that the MemHpa itself is not found, but not e.g. its target
+func isMemHPANotFound(err error) bool {
+	status, ok := err.(errors.APIStatus)
+	if !ok || !errors.IsNotFound(err) {
+		return false
 	}
+	details := status.Status().Details
+	return nil != details && memhpav1.MemHPAResourcesName == details.Kind
 }
 
-func (controller *HPAController) updateStatus(hpa *memhpav1.MemHpa, current, desired, utilization int32, rescale bool) {
-	modified := hpa.Status.CurrentUtilizationPercentage != utilization || hpa.Status.CurrentReplicas != current ||
-		hpa.Status.DesiredReplicas != desired
-	hpa.Status = memhpav1.MemHPAScalerStatus{
-		CurrentReplicas: current,
-		DesiredReplicas: desired,
-		CurrentUtilizationPercentage: utilization,
-		LastScaleTime: hpa.Status.LastScaleTime,
+// Write status through the status subresource. On conflicts, the status is written to the latest object again.
+func (controller *HPAController) writeStatus(hpa *memhpav1.MemHpa) error {
+	scalers := controller.hpaNamespacer.Scalers(hpa.MetaData.Namespace)
+	latest := hpa
+	for i := 0; ; i++ {
+		_, err := scalers.UpdateStatus(latest)
+		if nil == err || !errors.IsConflict(err) || i >= maxUpdateRetries - 1 {
+			return err
+		}
+		glog.V(2).Infof("Conflict on updating status of %s, retrying\n", hpaKey(hpa))
+		if latest, err = scalers.Get(hpa.MetaData.Name); nil != err {
+			return err
+		}
+		latest.Status = hpa.Status
+	}
+}
+
+// Export replicas and metrics of the status to monitoring
+func exportStatus(hpa *memhpav1.MemHpa, status memhpav1.MemHPAScalerStatus) {
+	namespace, name := hpa.MetaData.Namespace, hpa.MetaData.Name
+	monitoring.CurrentReplicas.WithLabelValues(namespace, name).Set(float64(status.CurrentReplicas))
+	monitoring.DesiredReplicas.WithLabelValues(namespace, name).Set(float64(status.DesiredReplicas))
+	if nil != hpa.Spec.MinReplicas {
+		monitoring.MinReplicas.WithLabelValues(namespace, name).Set(float64(*hpa.Spec.MinReplicas))
+	}
+	monitoring.MaxReplicas.WithLabelValues(namespace, name).Set(float64(hpa.Spec.MaxReplicas))
+
+	// drop series of removed metrics
+	for _, v := range []*prometheus.GaugeVec{monitoring.CurrentUtilization, monitoring.TargetUtilization,
+		monitoring.CurrentAverageValue, monitoring.TargetAverageValue} {
+
+		monitoring.DeleteSeries(v.MetricVec, namespace, name)
+	}
+	for i, m := range hpa.Spec.GetMetrics() {
+		index := strconv.Itoa(i)
+		if nil != m.TargetAverageValue {
+			monitoring.TargetAverageValue.WithLabelValues(namespace, name, index, string(m.Type)).
+				Set(quantityValue(m.TargetAverageValue))
+		} else if nil != m.TargetUtilizationPercentage {
+			monitoring.TargetUtilization.WithLabelValues(namespace, name, index, string(m.Type)).
+				Set(float64(*m.TargetUtilizationPercentage))
+		}
+		if i >= len(status.CurrentMetrics) || m.Type != status.CurrentMetrics[i].Type {
+			continue
+		}
+		current := status.CurrentMetrics[i]
+		if nil != current.CurrentUtilizationPercentage {
+			monitoring.CurrentUtilization.WithLabelValues(namespace, name, index, string(m.Type)).
+				Set(float64(*current.CurrentUtilizationPercentage))
+		}
+		if nil != current.CurrentAverageValue {
+			monitoring.CurrentAverageValue.WithLabelValues(namespace, name, index, string(m.Type)).
+				Set(quantityValue(current.CurrentAverageValue))
+		}
 	}
+}
+
+func quantityValue(q *resource.Quantity) float64 {
+	return float64(q.MilliValue()) / 1000
+}
+
+func (controller *HPAController) updateStatus(hpa *memhpav1.MemHpa, status memhpav1.MemHPAScalerStatus,
+	rescale bool) error {
+	// min replicas in effect, which is observed through the scale subresource of MemHpa
+	status.MinReplicas = *hpa.Spec.MinReplicas
+	exportStatus(hpa, status)
+
+	status.LastScaleTime = hpa.Status.LastScaleTime
+	modified := !api.Semantic.DeepEqual(hpa.Status, status)
+	hpa.Status = status
 
 	if rescale {
 		modified = true
@@ -236,56 +937,179 @@ func (controller *HPAController) updateStatus(hpa *memhpav1.MemHpa, current, des
 	}
 
 	if modified {
-		if _, err := controller.hpaNamespacer.Scalers(hpa.MetaData.Namespace).Update(hpa); nil != err {
+		if err := controller.writeStatus(hpa); isMemHPANotFound(err) {
+			return err
+		} else if nil != err {
 			controller.eventRecorder.Event(hpa, api.EventTypeWarning, "FailedUpdateStatus", err.Error())
 			glog.Errorf("Failed to update mem hpa status: %#v\n", err)
-			return
+			return err
 		}
 		glog.V(2).Infof("Successfully updated status for %s\n", hpa.MetaData.Name)
 	} else {
 		glog.V(2).Infoln("There is no need to update mem hpa")
 	}
+	return nil
 }
 
-func (controller *HPAController) computeReplicas(hpa *memhpav1.MemHpa, scale *apisv1beta1.Scale) (int32, int32, time.Time, error) {
-	targetUtilization := *hpa.Spec.TargetUtilizationPercentage
+// Compute desired replicas as the maximum of the proposals of all metrics and set observed metrics into status.
+// Return desired replicas, the metric which determines it, timestamp and error.
+func (controller *HPAController) computeReplicas(hpa *memhpav1.MemHpa, scale *autoscalingv1.Scale,
+	status *memhpav1.MemHPAScalerStatus) (int32, memhpav1.MetricSourceType, time.Time, error) {
+
 	currentReplicas := scale.Status.Replicas
 	nilTime := time.Time{}
 
-	if scale.Status.Selector == nil {
+	if "" == scale.Status.Selector {
 		err := "selector is required"
 		controller.eventRecorder.Event(hpa, api.EventTypeWarning, "SelectorRequired", err)
-		return 0, 0, nilTime, fmt.Errorf(err)
+		monitoring.MetricFetchErrors.WithLabelValues(hpa.MetaData.Namespace, hpa.MetaData.Name,
+			"SelectorRequired").Inc()
+		setCondition(status, memhpav1.ScalingActive, apiv1.ConditionFalse, "InvalidSelector",
+			"the HPA target's scale is missing a selector")
+		return 0, "", nilTime, fmt.Errorf("%s", err)
 	}
 
-	selector, err := unversioned.LabelSelectorAsSelector(&unversioned.LabelSelector{MatchLabels:scale.Status.Selector})
+	selector, err := labels.Parse(scale.Status.Selector)
 	if err != nil {
 		errMsg := fmt.Sprintf("couldn't convert selector string to a corresponding selector object: %v", err)
 		controller.eventRecorder.Event(hpa, api.EventTypeWarning, "InvalidSelector", errMsg)
-		return 0, 0, nilTime, fmt.Errorf(errMsg)
+		monitoring.MetricFetchErrors.WithLabelValues(hpa.MetaData.Namespace, hpa.MetaData.Name,
+			"InvalidSelector").Inc()
+		setCondition(status, memhpav1.ScalingActive, apiv1.ConditionFalse, "InvalidSelector",
+			"the HPA target's scale has an invalid selector: %v", err)
+		return 0, "", nilTime, fmt.Errorf("%s", errMsg)
 	}
 
-	desiredReplicas, utilization, timestamp, err :=
-		controller.replicaCalc.GetReplicas(currentReplicas, targetUtilization, hpa.MetaData.Namespace,
-			hpa.Spec.ScaleTargetRef.Name, selector)
-	if nil != err {
-		lastScaleTime := getLastScaleTime(hpa)
-		if time.Now().After(lastScaleTime.Add(upscaleForbiddenWindow)) {
-			controller.eventRecorder.Event(hpa, api.EventTypeWarning, "FailedGetMetrics", err.Error())
-		} else {
-			controller.eventRecorder.Event(hpa, api.EventTypeNormal, "MetricsNotAvailableYet", err.Error())
+	query := newMetricsQuery(hpa, selector, status.MemorySignal)
+	specs := hpa.Spec.GetMetrics()
+	status.CurrentMetrics = make([]memhpav1.MetricStatus, len(specs))
+	var desiredReplicas int32
+	var desiredMetric memhpav1.MetricSourceType
+	var timestamp time.Time
+	var failed int
+	var lastErr error
+	currents := make([]string, 0, len(specs))
+	for i, m := range specs {
+		status.CurrentMetrics[i].Type = m.Type
+		replicas, current, metricTime, err := controller.computeMetricReplicas(hpa, m, currentReplicas, query,
+			&status.CurrentMetrics[i])
+		if nil != err {
+			failed++
+			controller.recordMetricsFetch(false)
+			monitoring.MetricFetchErrors.WithLabelValues(hpa.MetaData.Namespace, hpa.MetaData.Name,
+				fmt.Sprintf("FailedGet%sMetric", m.Type)).Inc()
+			lastErr = err
+			msg := fmt.Sprintf("failed to get %s metric: %v", m.Type, err)
+			lastScaleTime := getLastScaleTime(hpa)
+			if time.Now().After(lastScaleTime.Add(stabilizationWindow(hpa.Spec.GetScaleUpRules()))) {
+				controller.eventRecorder.Event(hpa, api.EventTypeWarning, "FailedGetMetrics", msg)
+			} else {
+				controller.eventRecorder.Event(hpa, api.EventTypeNormal, "MetricsNotAvailableYet", msg)
+			}
+			continue
+		}
+		controller.recordMetricsFetch(true)
+		currents = append(currents, current)
+		if "" == desiredMetric || replicas > desiredReplicas {
+			desiredReplicas = replicas
+			desiredMetric = m.Type
+			timestamp = metricTime
+		}
+	}
+	if failed == len(specs) {
+		setCondition(status, memhpav1.ScalingActive, apiv1.ConditionFalse, "FailedGetMetrics",
+			"the HPA was unable to compute the replica count: %v", lastErr)
+		return 0, "", nilTime, fmt.Errorf("failed to get metrics: %v", lastErr)
+	}
+	if 0 < failed {
+		setCondition(status, memhpav1.ScalingActive, apiv1.ConditionTrue, "ValidMetricFound",
+			"the HPA was able to compute the replica count from %d of %d metrics, the last error: %v",
+			len(specs) - failed, len(specs), lastErr)
+		if desiredReplicas < currentReplicas {
+			// the failed metrics might still need the current replicas
+			glog.V(2).Infof("Not scaling down %s because %d metrics are unavailable\n", hpa.MetaData.Name, failed)
+			desiredReplicas = currentReplicas
 		}
+	} else {
+		setCondition(status, memhpav1.ScalingActive, apiv1.ConditionTrue, "ValidMetricFound",
+			"the HPA was able to successfully calculate a replica count from %s metric", desiredMetric)
+	}
 
-		return 0, 0, nilTime, fmt.Errorf("failed to get memory utilization: %v", err)
+	// keep the memory fields of status for clients reading them
+	for _, m := range status.CurrentMetrics {
+		if memhpav1.MemoryMetricSourceType != m.Type {
+			continue
+		}
+		if nil != m.CurrentUtilizationPercentage {
+			status.CurrentUtilizationPercentage = *m.CurrentUtilizationPercentage
+		}
+		status.CurrentAverageValue = m.CurrentAverageValue
+		status.PredictedUtilizationPercentage = m.PredictedUtilizationPercentage
+		status.PredictedAverageValue = m.PredictedAverageValue
+		break
 	}
 
 	if desiredReplicas != currentReplicas {
 		controller.eventRecorder.Eventf(hpa, api.EventTypeNormal, "DesiredReplicasComputed",
-			"Computed the desired num of replicas: %d (avgUtil: %d, current replicas: %d)",
-			desiredReplicas, utilization, currentReplicas)
+			"Computed the desired num of replicas: %d (%s, signal: %s, current replicas: %d)",
+			desiredReplicas, strings.Join(currents, ", "), status.MemorySignal, currentReplicas)
 	}
 
-	return desiredReplicas, utilization, timestamp, nil
+	return desiredReplicas, desiredMetric, timestamp, nil
+}
+
+// Compute the proposal of the metric and set its current value into status.
+// Return replicas, description of the current value, timestamp and error.
+func (controller *HPAController) computeMetricReplicas(hpa *memhpav1.MemHpa, metric memhpav1.MetricSpec,
+	currentReplicas int32, query metrics.MetricsQuery, status *memhpav1.MetricStatus) (int32, string, time.Time, error) {
+
+	nilTime := time.Time{}
+	query.Template = metric.Query
+	if memhpav1.MemoryMetricSourceType == metric.Type && "" == query.Template {
+		query.Template = hpa.Spec.MetricQuery
+	}
+
+	if nil != metric.TargetAverageValue {
+		// memory is in bytes, the others are in milli-units
+		target := metric.TargetAverageValue.MilliValue()
+		if memhpav1.MemoryMetricSourceType == metric.Type {
+			target = metric.TargetAverageValue.Value()
+		}
+		replicas, averageValue, predicted, timestamp, err := controller.replicaCalc.GetAverageValueReplicas(
+			metric.Type, currentReplicas, target, query, hpa.Spec.Prediction)
+		if nil != err {
+			return 0, "", nilTime, err
+		}
+		if memhpav1.MemoryMetricSourceType == metric.Type {
+			status.CurrentAverageValue = resource.NewQuantity(averageValue, resource.BinarySI)
+		} else {
+			status.CurrentAverageValue = resource.NewMilliQuantity(averageValue, resource.DecimalSI)
+		}
+		current := fmt.Sprintf("%s avgValue: %s", metric.Type, status.CurrentAverageValue.String())
+		if nil != predicted {
+			// only memory is forecast
+			status.PredictedAverageValue = resource.NewQuantity(*predicted, resource.BinarySI)
+			current += fmt.Sprintf(", predicted: %s", status.PredictedAverageValue.String())
+		}
+		return replicas, current, timestamp, nil
+	}
+
+	if nil == metric.TargetUtilizationPercentage {
+		return 0, "", nilTime, fmt.Errorf("target is required")
+	}
+	replicas, utilization, predicted, timestamp, err := controller.replicaCalc.GetReplicas(metric.Type,
+		currentReplicas, *metric.TargetUtilizationPercentage, hpa.Spec.UtilizationBase,
+		hpa.Spec.SkipContainersWithoutBase, query, hpa.Spec.Prediction)
+	if nil != err {
+		return 0, "", nilTime, err
+	}
+	status.CurrentUtilizationPercentage = &utilization
+	status.PredictedUtilizationPercentage = predicted
+	current := fmt.Sprintf("%s avgUtil: %d", metric.Type, utilization)
+	if nil != predicted {
+		current += fmt.Sprintf(", predicted: %d", *predicted)
+	}
+	return replicas, current, timestamp, nil
 }
 
 func getLastScaleTime(hpa *memhpav1.MemHpa) time.Time {
@@ -296,11 +1120,21 @@ func getLastScaleTime(hpa *memhpav1.MemHpa) time.Time {
 	return lastTime.Time
 }
 
-// Validate fields and update invalid fields,
-// return whether it is valid
+// Validate fields and correct invalid fields in memory for this reconciliation, they are not written back.
+// Return whether any field was corrected.
 func (controller *HPAController) validate(hpa *memhpav1.MemHpa) bool {
 	var modified bool
-	if nil == hpa.Spec.MinReplicas || *hpa.Spec.MinReplicas < 1 {
+	if nil != hpa.Spec.ScaleToZero {
+		path := field.NewPath("spec", "scaleToZero")
+		if errs := memhpav1.ValidateScaleToZero(hpa.Spec.ScaleToZero, hpa.Spec.MaxReplicas, path); 0 < len(errs) {
+			controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+				fmt.Sprintf(".spec.scaleToZero is invalid and will be ignored: %v", errs.ToAggregate()))
+			hpa.Spec.ScaleToZero = nil
+			modified = true
+		}
+	}
+	if nil == hpa.Spec.MinReplicas || *hpa.Spec.MinReplicas < 0 ||
+		(0 == *hpa.Spec.MinReplicas && nil == hpa.Spec.ScaleToZero) {
 		if nil == hpa.Spec.MinReplicas {
 			hpa.Spec.MinReplicas = new(int32)
 		}
@@ -311,13 +1145,19 @@ func (controller *HPAController) validate(hpa *memhpav1.MemHpa) bool {
 	}
 
 	if hpa.Spec.MaxReplicas < *hpa.Spec.MinReplicas {
-		hpa.Spec.MaxReplicas = *hpa.Spec.MinReplicas + scaleUpLimitMinimum
+		hpa.Spec.MaxReplicas = *hpa.Spec.MinReplicas + memhpav1.DefaultScaleUpLimitMinimum
 		controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
 			fmt.Sprintf(".spec.maxReplicas is invalid and will be set to %d", hpa.Spec.MaxReplicas ))
 		modified = true
 	}
-	if nil == hpa.Spec.TargetUtilizationPercentage || *hpa.Spec.TargetUtilizationPercentage < 1 ||
-		*hpa.Spec.TargetUtilizationPercentage > 100 {
+	if nil != hpa.Spec.TargetAverageValue && hpa.Spec.TargetAverageValue.Sign() <= 0 {
+		hpa.Spec.TargetAverageValue = nil
+		controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+			".spec.targetAverageValue is invalid and will be unset")
+		modified = true
+	}
+	if nil == hpa.Spec.TargetAverageValue && (nil == hpa.Spec.TargetUtilizationPercentage ||
+		*hpa.Spec.TargetUtilizationPercentage < 1 || *hpa.Spec.TargetUtilizationPercentage > 100) {
 
 		if nil == hpa.Spec.TargetUtilizationPercentage{
 			hpa.Spec.TargetUtilizationPercentage = new(int32)
@@ -328,5 +1168,84 @@ func (controller *HPAController) validate(hpa *memhpav1.MemHpa) bool {
 		modified = true
 
 	}
-	return !modified
+	switch hpa.Spec.MemorySignal {
+	case "", memhpav1.MemorySignalUsage, memhpav1.MemorySignalWorkingSet, memhpav1.MemorySignalRSS,
+		memhpav1.MemorySignalUsageWithoutCache:
+	default:
+		controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+			fmt.Sprintf(".spec.memorySignal %q is invalid and will be unset", hpa.Spec.MemorySignal))
+		hpa.Spec.MemorySignal = ""
+		modified = true
+	}
+	switch hpa.Spec.UtilizationBase {
+	case "", memhpav1.UtilizationBaseLimits, memhpav1.UtilizationBaseRequests,
+		memhpav1.UtilizationBaseLimitsOrRequests:
+	default:
+		controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+			fmt.Sprintf(".spec.utilizationBase %q is invalid and will be set to %s", hpa.Spec.UtilizationBase,
+				memhpav1.UtilizationBaseLimits))
+		hpa.Spec.UtilizationBase = memhpav1.UtilizationBaseLimits
+		modified = true
+	}
+	switch hpa.Spec.Mode {
+	case "", memhpav1.AutoScalingMode, memhpav1.RecommendOnlyScalingMode, memhpav1.OffScalingMode:
+	default:
+		// don't scale since the mode may be a misspelled RecommendOnly or Off
+		controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+			fmt.Sprintf(".spec.mode %q is invalid and will be set to %s", hpa.Spec.Mode,
+				memhpav1.RecommendOnlyScalingMode))
+		hpa.Spec.Mode = memhpav1.RecommendOnlyScalingMode
+		modified = true
+	}
+	if 0 < len(hpa.Spec.Metrics) {
+		metrics := make([]memhpav1.MetricSpec, 0, len(hpa.Spec.Metrics))
+		for i, m := range hpa.Spec.Metrics {
+			if errs := memhpav1.ValidateMetric(&m, field.NewPath("spec", "metrics").Index(i)); 0 < len(errs) {
+				controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+					fmt.Sprintf(".spec.metrics[%d] is invalid and will be removed: %v", i, errs.ToAggregate()))
+				modified = true
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+		hpa.Spec.Metrics = metrics
+	}
+	if nil != hpa.Spec.Prediction {
+		if errs := memhpav1.ValidatePrediction(hpa.Spec.Prediction, field.NewPath("spec", "prediction")); 0 < len(errs) {
+			controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+				fmt.Sprintf(".spec.prediction is invalid and will be ignored: %v", errs.ToAggregate()))
+			hpa.Spec.Prediction = nil
+			modified = true
+		}
+	}
+	if 0 < len(hpa.Spec.Schedules) {
+		schedules := make([]memhpav1.ScheduleSpec, 0, len(hpa.Spec.Schedules))
+		for i, s := range hpa.Spec.Schedules {
+			if errs := memhpav1.ValidateSchedule(&s, field.NewPath("spec", "schedules").Index(i)); 0 < len(errs) {
+				controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+					fmt.Sprintf(".spec.schedules[%d] is invalid and will be ignored: %v", i, errs.ToAggregate()))
+				modified = true
+				continue
+			}
+			schedules = append(schedules, s)
+		}
+		hpa.Spec.Schedules = schedules
+	}
+	if nil != hpa.Spec.Behavior {
+		path := field.NewPath("spec", "behavior")
+		if errs := memhpav1.ValidateScalingRules(hpa.Spec.Behavior.ScaleUp, path.Child("scaleUp")); 0 < len(errs) {
+			controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+				fmt.Sprintf(".spec.behavior.scaleUp is invalid and defaults will be used: %v", errs.ToAggregate()))
+			hpa.Spec.Behavior.ScaleUp = nil
+			modified = true
+		}
+		errs := memhpav1.ValidateScalingRules(hpa.Spec.Behavior.ScaleDown, path.Child("scaleDown"))
+		if 0 < len(errs) {
+			controller.eventRecorder.Event(hpa, apiv1.EventTypeNormal, "ValidationPolicy",
+				fmt.Sprintf(".spec.behavior.scaleDown is invalid and defaults will be used: %v", errs.ToAggregate()))
+			hpa.Spec.Behavior.ScaleDown = nil
+			modified = true
+		}
+	}
+	return modified
 }
\ No newline at end of file
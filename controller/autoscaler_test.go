@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	memhpav1 "memhpa/apis/v1"
+	"memhpa/client"
+	"memhpa/controller/workqueue"
+
+	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
+	"k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	autoscalingv1 "k8s.io/client-go/1.4/pkg/apis/autoscaling/v1"
+	"k8s.io/client-go/1.4/tools/cache"
+	"k8s.io/client-go/1.4/tools/record"
+)
+
+var memHPAResource = unversioned.GroupResource{Group: memhpav1.MemHPAResourcesGroup,
+	Resource: memhpav1.MemHPAResourcesName}
+
+// MemHpa client of a single stored MemHpa in any namespace, the other methods are not implemented
+type fakeScalers struct {
+	client.MemHPAScalerInterface
+	stored *memhpav1.MemHpa
+	// Update fails with conflicts this many times
+	conflicts int
+	updates int
+}
+
+func (f *fakeScalers) Scalers(namespace string) client.MemHPAScalerInterface {
+	return f
+}
+
+func (f *fakeScalers) Get(name string) (*memhpav1.MemHpa, error) {
+	if nil == f.stored {
+		return nil, errors.NewNotFound(memHPAResource, name)
+	}
+	hpa := *f.stored
+	return &hpa, nil
+}
+
+func (f *fakeScalers) Update(hpa *memhpav1.MemHpa) (*memhpav1.MemHpa, error) {
+	f.updates++
+	if nil == f.stored {
+		return nil, errors.NewNotFound(memHPAResource, hpa.MetaData.Name)
+	}
+	if 0 < f.conflicts {
+		f.conflicts--
+		return nil, errors.NewConflict(memHPAResource, hpa.MetaData.Name, fmt.Errorf("conflict"))
+	}
+	if hpa.MetaData.ResourceVersion != f.stored.MetaData.ResourceVersion {
+		return nil, errors.NewConflict(memHPAResource, hpa.MetaData.Name, fmt.Errorf("stale resource version"))
+	}
+	updated := *hpa
+	var version int
+	fmt.Sscan(f.stored.MetaData.ResourceVersion, &version)
+	updated.MetaData.ResourceVersion = fmt.Sprint(version + 1)
+	f.stored = &updated
+	result := updated
+	return &result, nil
+}
+
+func (f *fakeScalers) UpdateStatus(hpa *memhpav1.MemHpa) (*memhpav1.MemHpa, error) {
+	return f.Update(hpa)
+}
+
+// Events getter of any namespace, no method is implemented
+type fakeEvents struct {
+	v1.EventInterface
+}
+
+func (f *fakeEvents) Events(namespace string) v1.EventInterface {
+	return f
+}
+
+// Scales of targets returning the same scale for any target
+type fakeTargetScales struct {
+	scale autoscalingv1.Scale
+}
+
+func (f *fakeTargetScales) TargetScales(namespace string) client.TargetScaleInterface {
+	return f
+}
+
+func (f *fakeTargetScales) Get(ref autoscalingv1.CrossVersionObjectReference) (*autoscalingv1.Scale, error) {
+	scale := f.scale
+	return &scale, nil
+}
+
+func (f *fakeTargetScales) Update(ref autoscalingv1.CrossVersionObjectReference,
+	scale *autoscalingv1.Scale) (*autoscalingv1.Scale, error) {
+
+	f.scale = *scale
+	return scale, nil
+}
+
+// Return a controller of MemHpa in the store without running the informer, MemHpa are written to scalers
+func newTestController(scalers *fakeScalers, hpas ...*memhpav1.MemHpa) *HPAController {
+	controller := &HPAController{
+		scaleNamespacer: &fakeTargetScales{},
+		hpaNamespacer: scalers,
+		replicaCalc: NewReplicaCalculator(&fakeMetrics{}, nil, nil, &fakePods{}),
+		eventRecorder: record.NewFakeRecorder(100),
+		store: cache.NewStore(cache.MetaNamespaceKeyFunc),
+		queue: workqueue.NewRateLimitingQueue(time.Millisecond, time.Second),
+		scaleEvents: make(map[string][]scaleEvent),
+		recommendations: make(map[string]*recommendationBuffer),
+		requeues: make(map[string]time.Time),
+	}
+	for _, hpa := range hpas {
+		controller.store.Add(hpa)
+	}
+	return controller
+}
+
+// Return a MemHpa default/name with defaults set
+func newTestHPA(name string) *memhpav1.MemHpa {
+	hpa := &memhpav1.MemHpa{}
+	hpa.MetaData.Namespace = "default"
+	hpa.MetaData.Name = name
+	hpa.MetaData.ResourceVersion = "1"
+	hpa.Spec.MaxReplicas = 5
+	memhpav1.SetDefaults(hpa)
+	return hpa
+}
+
+func scalingRules(selectPolicy memhpav1.ScalingPolicySelect, policies ...memhpav1.HPAScalingPolicy) memhpav1.HPAScalingRules {
+	return memhpav1.HPAScalingRules{SelectPolicy: selectPolicy, Policies: policies}
+}
+
+func podsPolicy(value, periodSeconds int32) memhpav1.HPAScalingPolicy {
+	return memhpav1.HPAScalingPolicy{Type: memhpav1.PodsScalingPolicy, Value: value, PeriodSeconds: periodSeconds}
+}
+
+func percentPolicy(value, periodSeconds int32) memhpav1.HPAScalingPolicy {
+	return memhpav1.HPAScalingPolicy{Type: memhpav1.PercentScalingPolicy, Value: value, PeriodSeconds: periodSeconds}
+}
+
+func TestGetScaleUpLimit(t *testing.T) {
+	now := time.Now()
+	spec := &memhpav1.MemHPASpec{}
+	defaults := spec.GetScaleUpRules()
+	minimum := spec.GetScaleUpLimitMinimum()
+	tests := []struct {
+		name string
+		current int32
+		rules memhpav1.HPAScalingRules
+		minimum int32
+		events []scaleEvent
+		expected int32
+	}{
+		{"default from 1 up to 4", 1, defaults, minimum, nil, 4},
+		{"default from 2 up to 4", 2, defaults, minimum, nil, 4},
+		{"default from 3 up to 6", 3, defaults, minimum, nil, 6},
+		{"default from 10 doubles", 10, defaults, minimum, nil, 20},
+		{"default counts pods added in the period", 6, defaults, minimum,
+			[]scaleEvent{{replicaChange: 3, timestamp: now.Add(-30 * time.Second)}}, 6},
+		{"default ignores pods added before the period", 6, defaults, minimum,
+			[]scaleEvent{{replicaChange: 3, timestamp: now.Add(-90 * time.Second)}}, 12},
+		{"default ignores pods removed in the period", 6, defaults, minimum,
+			[]scaleEvent{{replicaChange: -2, timestamp: now.Add(-30 * time.Second)}}, 12},
+		{"default up to 4 after pods added in the period", 2, defaults, minimum,
+			[]scaleEvent{{replicaChange: 1, timestamp: now.Add(-30 * time.Second)}}, 4},
+		{"min selects the smallest change", 10, scalingRules(memhpav1.MinPolicySelect, podsPolicy(4, 60),
+			percentPolicy(100, 60)), 0, nil, 14},
+		{"disabled keeps current", 10, scalingRules(memhpav1.DisabledPolicySelect, podsPolicy(4, 60)), 0, nil, 10},
+		{"disabled ignores minimum", 1, scalingRules(memhpav1.DisabledPolicySelect), 4, nil, 1},
+		{"not less than current", 10, scalingRules(memhpav1.MaxPolicySelect, percentPolicy(50, 60)), 0,
+			[]scaleEvent{{replicaChange: 10, timestamp: now.Add(-10 * time.Second)}}, 10},
+		{"percent rounds up", 3, scalingRules(memhpav1.MaxPolicySelect, percentPolicy(50, 60)), 0, nil, 5},
+		{"max of policies with different periods", 10, scalingRules(memhpav1.MaxPolicySelect, podsPolicy(4, 60),
+			percentPolicy(100, 600)), 0, []scaleEvent{{replicaChange: 5, timestamp: now.Add(-120 * time.Second)}}, 14},
+		{"min of policies with different periods", 10, scalingRules(memhpav1.MinPolicySelect, podsPolicy(4, 60),
+			percentPolicy(100, 600)), 0, []scaleEvent{{replicaChange: 5, timestamp: now.Add(-120 * time.Second)}}, 10},
+	}
+	for _, test := range tests {
+		if limit := getScaleUpLimit(test.current, test.rules, test.minimum, test.events, now); test.expected != limit {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, limit)
+		}
+	}
+}
+
+func TestGetScaleUpLimitMinimum(t *testing.T) {
+	tests := []struct {
+		name string
+		behavior *memhpav1.MemHPAScalingBehavior
+		expected int32
+	}{
+		{"without behavior", nil, memhpav1.DefaultScaleUpLimitMinimum},
+		{"without scale up policies", &memhpav1.MemHPAScalingBehavior{ScaleUp: &memhpav1.HPAScalingRules{}},
+			memhpav1.DefaultScaleUpLimitMinimum},
+		{"with scale up policies", &memhpav1.MemHPAScalingBehavior{ScaleUp: &memhpav1.HPAScalingRules{
+			Policies: []memhpav1.HPAScalingPolicy{percentPolicy(100, 60)}}}, 0},
+	}
+	for _, test := range tests {
+		spec := &memhpav1.MemHPASpec{Behavior: test.behavior}
+		if minimum := spec.GetScaleUpLimitMinimum(); test.expected != minimum {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, minimum)
+		}
+	}
+}
+
+func TestGetScaleDownLimit(t *testing.T) {
+	now := time.Now()
+	defaults := (&memhpav1.MemHPASpec{}).GetScaleDownRules()
+	tests := []struct {
+		name string
+		current int32
+		rules memhpav1.HPAScalingRules
+		events []scaleEvent
+		expected int32
+	}{
+		{"default removes all", 10, defaults, nil, 0},
+		{"pods", 10, scalingRules(memhpav1.MaxPolicySelect, podsPolicy(2, 60)), nil, 8},
+		{"percent rounds down", 5, scalingRules(memhpav1.MaxPolicySelect, percentPolicy(50, 60)), nil, 2},
+		{"counts pods removed in the period", 7, scalingRules(memhpav1.MaxPolicySelect, podsPolicy(4, 60)),
+			[]scaleEvent{{replicaChange: -3, timestamp: now.Add(-30 * time.Second)}}, 6},
+		{"not greater than current", 6, scalingRules(memhpav1.MaxPolicySelect, podsPolicy(4, 60)),
+			[]scaleEvent{{replicaChange: -4, timestamp: now.Add(-30 * time.Second)}}, 6},
+		{"ignores pods removed before the period", 6, scalingRules(memhpav1.MaxPolicySelect, podsPolicy(4, 60)),
+			[]scaleEvent{{replicaChange: -4, timestamp: now.Add(-90 * time.Second)}}, 2},
+		{"max selects the fewest replicas", 10, scalingRules(memhpav1.MaxPolicySelect, podsPolicy(2, 60),
+			percentPolicy(50, 60)), nil, 5},
+		{"min selects the most replicas", 10, scalingRules(memhpav1.MinPolicySelect, podsPolicy(2, 60),
+			percentPolicy(50, 60)), nil, 8},
+		{"disabled keeps current", 10, scalingRules(memhpav1.DisabledPolicySelect, podsPolicy(2, 60)), nil, 10},
+	}
+	for _, test := range tests {
+		if limit := getScaleDownLimit(test.current, test.rules, test.events, now); test.expected != limit {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, limit)
+		}
+	}
+}
+
+func TestStabilizeScaleDown(t *testing.T) {
+	zero := int32(0)
+	tests := []struct {
+		name string
+		behavior *memhpav1.MemHPAScalingBehavior
+		past []timestampedRecommendation
+		current int32
+		recommendation int32
+		expected int32
+		expectedStabilized bool
+	}{
+		{"scale up is not stabilized", nil, []timestampedRecommendation{{2, time.Now().Add(-100 * time.Second)}},
+			5, 8, 8, false},
+		{"first recommendation", nil, nil, 10, 3, 3, false},
+		{"max in the window", nil, []timestampedRecommendation{{8, time.Now().Add(-100 * time.Second)}},
+			10, 4, 8, false},
+		{"not more than current", nil, []timestampedRecommendation{{12, time.Now().Add(-100 * time.Second)}},
+			10, 4, 10, false},
+		{"covered window", nil, []timestampedRecommendation{{6, time.Now().Add(-400 * time.Second)},
+			{5, time.Now().Add(-100 * time.Second)}}, 10, 3, 5, true},
+		{"zero window", &memhpav1.MemHPAScalingBehavior{ScaleDown: &memhpav1.HPAScalingRules{
+			StabilizationWindowSeconds: &zero}}, []timestampedRecommendation{{8, time.Now().Add(-100 * time.Second)}},
+			10, 3, 3, true},
+	}
+	for _, test := range tests {
+		hpa := &memhpav1.MemHpa{Spec: memhpav1.MemHPASpec{Behavior: test.behavior}}
+		hpa.MetaData.Namespace, hpa.MetaData.Name = "default", "test"
+		controller := &HPAController{recommendations: map[string]*recommendationBuffer{}}
+		if 0 < len(test.past) {
+			buffer := newRecommendationBuffer(maxRecommendations)
+			for _, r := range test.past {
+				buffer.add(r.replicas, r.timestamp)
+			}
+			controller.recommendations[hpaKey(hpa)] = buffer
+		}
+		replicas, stabilized := controller.stabilizeScaleDown(hpa, test.current, test.recommendation)
+		if test.expected != replicas || test.expectedStabilized != stabilized {
+			t.Errorf("%s: expected %d, %v, got %d, %v", test.name, test.expected, test.expectedStabilized, replicas,
+				stabilized)
+		}
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	newHPA := func(resourceVersion string, defaults bool) *memhpav1.MemHpa {
+		hpa := &memhpav1.MemHpa{}
+		hpa.MetaData.Namespace = "default"
+		hpa.MetaData.Name = "a"
+		hpa.MetaData.ResourceVersion = resourceVersion
+		if defaults {
+			memhpav1.SetDefaults(hpa)
+		}
+		return hpa
+	}
+	tests := []struct {
+		name string
+		hpa *memhpav1.MemHpa
+		stored *memhpav1.MemHpa
+		conflicts int
+		expectedVersion string
+		expectedUpdates int
+	}{
+		{"defaults are set", newHPA("1", true), newHPA("1", true), 0, "1", 0},
+		{"defaults are written", newHPA("1", false), newHPA("1", false), 0, "2", 1},
+		{"defaults are written to the latest", newHPA("1", false), newHPA("3", false), 0, "4", 2},
+		{"defaults were written by others", newHPA("1", false), newHPA("3", true), 0, "3", 1},
+		{"writing fails", newHPA("1", false), newHPA("1", false), maxUpdateRetries, "1", maxUpdateRetries},
+	}
+	for _, test := range tests {
+		scalers := &fakeScalers{stored: test.stored, conflicts: test.conflicts}
+		controller := &HPAController{hpaNamespacer: scalers}
+		hpa := controller.applyDefaults(test.hpa)
+		if test.expectedVersion != hpa.MetaData.ResourceVersion || test.expectedUpdates != scalers.updates {
+			t.Errorf("%s: expected version %s after %d updates, got %s after %d updates", test.name,
+				test.expectedVersion, test.expectedUpdates, hpa.MetaData.ResourceVersion, scalers.updates)
+		}
+		if nil == hpa.Spec.MinReplicas || memhpav1.AutoScalingMode != hpa.Spec.Mode {
+			t.Errorf("%s: expected defaults, got %#v", test.name, hpa.Spec)
+		}
+	}
+}
+
+func TestDeleteWithPendingRequeue(t *testing.T) {
+	hpa := newTestHPA("a")
+	controller := newTestController(&fakeScalers{}, hpa)
+	key := hpaKey(hpa)
+	controller.requeueAt(key, time.Now().Add(20 * time.Millisecond))
+
+	// deleted while a requeue is pending, and a reconcile in flight keeps a requeue again
+	controller.store.Delete(hpa)
+	controller.forget(key)
+	controller.requeueAt(key, time.Now().Add(10 * time.Millisecond))
+
+	for i := 0; i < 2; i++ {
+		done := make(chan bool)
+		go func() {
+			done <- controller.processNextKey()
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("the pending requeue was not processed")
+		}
+	}
+	if 0 != controller.queue.Len() || 0 != controller.queue.NumRequeues(key) {
+		t.Errorf("expected no waiting keys nor failures, got %d waiting keys and %d failures",
+			controller.queue.Len(), controller.queue.NumRequeues(key))
+	}
+	if _, found := controller.requeues[key]; found {
+		t.Errorf("expected the pending requeue to be forgotten")
+	}
+}
+
+func TestDeleteWhileReconciling(t *testing.T) {
+	// the informer hasn't observed the deletion yet, so it is still in the store
+	hpa := newTestHPA("a")
+	controller := newTestController(&fakeScalers{}, hpa)
+	key := hpaKey(hpa)
+	controller.queue.Add(key)
+	if !controller.processNextKey() {
+		t.Fatalf("expected to process the key")
+	}
+	if 0 != controller.queue.NumRequeues(key) {
+		t.Errorf("expected the key to be forgotten, got %d failures", controller.queue.NumRequeues(key))
+	}
+	time.Sleep(10 * time.Millisecond)
+	if 0 != controller.queue.Len() {
+		t.Errorf("expected the key not to be requeued, got %d waiting keys", controller.queue.Len())
+	}
+}
+
+func TestIsMemHPANotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"mem hpa not found", errors.NewNotFound(memHPAResource, "a"), true},
+		{"target not found", errors.NewNotFound(unversioned.GroupResource{Group: "apps", Resource: "deployments"},
+			"a"), false},
+		{"conflict", errors.NewConflict(memHPAResource, "a", fmt.Errorf("conflict")), false},
+		{"other", fmt.Errorf("not found"), false},
+	}
+	for _, test := range tests {
+		if found := isMemHPANotFound(test.err); test.expected != found {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, found)
+		}
+	}
+}
+
+func TestChecksOfStandby(t *testing.T) {
+	controller := NewHPAController(&fakeEvents{}, &fakeTargetScales{}, &fakeScalers{},
+		NewReplicaCalculator(&fakeMetrics{}, nil, nil, &fakePods{}), 30 * time.Second, false)
+	for name, check := range map[string]func() error{"reconcile": controller.CheckReconciles,
+		"informer-sync": controller.CheckSynced, "metrics": controller.CheckMetrics} {
+
+		if err := check(); nil != err {
+			t.Errorf("%s: expected to pass before running, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"fmt"
+
+	memhpav1 "memhpa/apis/v1"
+
+	apiv1 "k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+)
+
+// Set the condition in status. Its lastTransitionTime is only updated if its status changes.
+func setCondition(status *memhpav1.MemHPAScalerStatus, conditionType memhpav1.MemHPAConditionType,
+	conditionStatus apiv1.ConditionStatus, reason, format string, args ...interface{}) {
+
+	message := fmt.Sprintf(format, args...)
+	for i := range status.Conditions {
+		c := &status.Conditions[i]
+		if c.Type != conditionType {
+			continue
+		}
+		if c.Status != conditionStatus {
+			c.LastTransitionTime = unversioned.Now()
+		}
+		c.Status = conditionStatus
+		c.Reason = reason
+		c.Message = message
+		return
+	}
+	status.Conditions = append(status.Conditions, memhpav1.MemHPACondition{
+		Type: conditionType,
+		Status: conditionStatus,
+		LastTransitionTime: unversioned.Now(),
+		Reason: reason,
+		Message: message,
+	})
+}
+
+// Return a copy of conditions which can be modified without changing the original ones
+func copyConditions(conditions []memhpav1.MemHPACondition) []memhpav1.MemHPACondition {
+	if nil == conditions {
+		return nil
+	}
+	return append(make([]memhpav1.MemHPACondition, 0, len(conditions)), conditions...)
+}
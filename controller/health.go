@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reconciles or metrics fetches are considered stalled if none finished or succeeded within this many resync periods
+const stalledResyncPeriods = 3
+
+func (controller *HPAController) recordReconcile() {
+	controller.healthLock.Lock()
+	defer controller.healthLock.Unlock()
+	controller.lastReconcileTime = time.Now()
+}
+
+func (controller *HPAController) recordMetricsFetch(succeeded bool) {
+	controller.healthLock.Lock()
+	defer controller.healthLock.Unlock()
+	if succeeded {
+		controller.lastMetricsSuccessTime = time.Now()
+	} else {
+		controller.lastMetricsFailureTime = time.Now()
+	}
+}
+
+// Liveness check failing if there are HPAs but no reconcile finished within stalledResyncPeriods resync periods.
+// All HPAs are reconciled every resync period, so the reconcile loop or the informer is stalled.
+func (controller *HPAController) CheckReconciles() error {
+	if !controller.informer.HasSynced() || 0 == len(controller.store.ListKeys()) {
+		return nil
+	}
+	controller.healthLock.Lock()
+	defer controller.healthLock.Unlock()
+	return checkStalled("reconcile", controller.lastReconcileTime, controller.startTime, controller.resyncPeriod)
+}
+
+// Readiness check failing until HPAs are listed once the controller runs. It passes before, so that standby
+// replicas waiting for the leadership are ready to serve webhooks.
+func (controller *HPAController) CheckSynced() error {
+	controller.healthLock.Lock()
+	running := !controller.startTime.IsZero()
+	controller.healthLock.Unlock()
+	if running && !controller.informer.HasSynced() {
+		return fmt.Errorf("mem hpa informer has not synced")
+	}
+	return nil
+}
+
+// Health detail failing if metrics fetches are failing and none succeeded within stalledResyncPeriods resync
+// periods, e.g. the metrics backend is unreachable. Neither restarting the controller nor routing webhooks to
+// another replica helps, so it should not fail liveness or readiness.
+func (controller *HPAController) CheckMetrics() error {
+	controller.healthLock.Lock()
+	defer controller.healthLock.Unlock()
+	if !controller.lastMetricsFailureTime.After(controller.lastMetricsSuccessTime) {
+		return nil
+	}
+	return checkStalled("successful metrics fetch", controller.lastMetricsSuccessTime, controller.startTime,
+		controller.resyncPeriod)
+}
+
+// Return an error if last, or start if last is zero, is earlier than stalledResyncPeriods resync periods ago
+func checkStalled(what string, last, start time.Time, resyncPeriod time.Duration) error {
+	since := "start"
+	if last.IsZero() {
+		last = start
+	} else {
+		since = last.Format(time.RFC3339)
+	}
+	if time.Since(last) > stalledResyncPeriods * resyncPeriod {
+		return fmt.Errorf("no %s since %s", what, since)
+	}
+	return nil
+}
@@ -7,7 +7,6 @@ import (
 
 	"sync"
 	"time"
-	"k8s.io/client-go/1.4/pkg/util/wait"
 )
 
 type Informer struct {
@@ -31,6 +30,9 @@ type Config struct {
 
 type ProcessFunc func(obj interface{}) error
 
+// Added to Queue to wake up Pop() after stop. Its key is not a valid key of K8S resources.
+var stopMarker = cache.ExplicitKey("\x00stop")
+
 type ResourceEventHandler interface {
 	OnAdd(obj interface{})
 	OnUpdate(oldObj, newObj interface{})
@@ -125,12 +127,30 @@ func (i *Informer) Run(stopCh <-chan struct{}) {
 
 	// Run a reflector to watch resources operations and enqueue
 	reflector.RunUntil(stopCh)
-	// Run a loop to pop a object from Queue and call Process
-	wait.Until(
-		func() {
-			i.config.Queue.Pop(cache.PopProcessFunc(i.config.Process))
-		},
-		time.Second,
-		stopCh,
-	)
+	// Pop() blocks while Queue is empty, so wake it up after stop
+	go func() {
+		<-stopCh
+		i.config.Queue.Add(stopMarker)
+	}()
+	// Run a loop to pop a object from Queue and call Process until stop
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		i.config.Queue.Pop(cache.PopProcessFunc(i.process))
+	}
+}
+
+// Return whether the first list of resources has been processed
+func (i *Informer) HasSynced() bool {
+	return i.config.Queue.HasSynced()
+}
+
+func (i *Informer) process(obj interface{}) error {
+	if deltas, ok := obj.(cache.Deltas); ok && stopMarker == deltas.Newest().Object {
+		return nil
+	}
+	return i.config.Process(obj)
 }
\ No newline at end of file
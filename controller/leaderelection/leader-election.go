@@ -0,0 +1,256 @@
+package leaderelection
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
+	"k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	apiv1 "k8s.io/client-go/1.4/pkg/api/v1"
+	utilruntime "k8s.io/client-go/1.4/pkg/util/runtime"
+	"k8s.io/client-go/1.4/pkg/util/wait"
+
+	"github.com/golang/glog"
+)
+
+// Annotation of the lock ConfigMap holding the LeaderElectionRecord, the same as K8S components
+const LeaderElectionRecordAnnotationKey = "control-plane.alpha.kubernetes.io/leader"
+
+// Record of the leader stored in the lock
+type LeaderElectionRecord struct {
+	HolderIdentity string `json:"holderIdentity"`
+	LeaseDurationSeconds int `json:"leaseDurationSeconds"`
+	AcquireTime unversioned.Time `json:"acquireTime"`
+	RenewTime unversioned.Time `json:"renewTime"`
+	LeaderTransitions int `json:"leaderTransitions"`
+}
+
+type Config struct {
+	// Client of the lock ConfigMap
+	ConfigMapsGetter v1.ConfigMapsGetter
+	// Namespace and name of the lock ConfigMap, it is created if it doesn't exist
+	Namespace string
+	Name string
+	// Unique identity of the candidate
+	Identity string
+
+	// Duration that candidates wait since the last observed renewal before taking over the leadership
+	LeaseDuration time.Duration
+	// Duration that the leader retries renewing before giving up the leadership
+	RenewDeadline time.Duration
+	// Duration between tries of acquiring and renewing
+	RetryPeriod time.Duration
+
+	// Called in a goroutine once the leadership is acquired, stop is closed when the leadership is lost
+	OnStartedLeading func(stop <-chan struct{})
+	// Called when the leadership is lost, but not when it is released after stop
+	OnStoppedLeading func()
+}
+
+// Elect a leader among candidates with the same lock by renewing the LeaderElectionRecord of the lock.
+// A candidate takes over the leadership if the record isn't renewed within LeaseDuration.
+type LeaderElector struct {
+	config Config
+	// The last observed record and the local time when it was observed, remote timestamps are not
+	// trusted because of clock skew
+	observedRecord LeaderElectionRecord
+	observedTime time.Time
+}
+
+func NewLeaderElector(config Config) (*LeaderElector, error) {
+	if config.LeaseDuration <= config.RenewDeadline {
+		return nil, fmt.Errorf("lease duration must be greater than renew deadline")
+	}
+	if config.RenewDeadline <= config.RetryPeriod {
+		return nil, fmt.Errorf("renew deadline must be greater than retry period")
+	}
+	if "" == config.Identity {
+		return nil, fmt.Errorf("identity must not be empty")
+	}
+	if nil == config.OnStartedLeading || nil == config.OnStoppedLeading {
+		return nil, fmt.Errorf("OnStartedLeading and OnStoppedLeading must be set")
+	}
+	return &LeaderElector{config: config}, nil
+}
+
+// Block until the leadership is acquired and lost, or stopCh is closed. After stop, keep renewing until
+// OnStartedLeading returns, so that no candidate takes over while it is draining however long it takes,
+// then release the leadership, so that a candidate takes over at once.
+func (le *LeaderElector) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	if !le.acquire(stopCh) {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		le.config.OnStartedLeading(stop)
+	}()
+	le.renew(stopCh)
+	close(stop)
+
+	select {
+	case <-stopCh:
+		le.renew(done)
+		<-done
+		le.release()
+	default:
+		le.config.OnStoppedLeading()
+	}
+}
+
+// Try to acquire the leadership every RetryPeriod, return false if stopCh is closed before it is acquired
+func (le *LeaderElector) acquire(stopCh <-chan struct{}) bool {
+	glog.Infof("Attempting to acquire leader lease %s/%s\n", le.config.Namespace, le.config.Name)
+	for {
+		if le.tryAcquireOrRenew() {
+			glog.Infof("Successfully acquired lease %s/%s as %s\n", le.config.Namespace, le.config.Name,
+				le.config.Identity)
+			return true
+		}
+		glog.V(4).Infof("Failed to acquire lease %s/%s\n", le.config.Namespace, le.config.Name)
+		select {
+		case <-stopCh:
+			return false
+		case <-time.After(wait.Jitter(le.config.RetryPeriod, 1.2)):
+		}
+	}
+}
+
+// Renew the leadership every RetryPeriod, return once it fails to renew within RenewDeadline or stopCh is closed.
+// It is also used to keep the leadership until OnStartedLeading returns after stop.
+func (le *LeaderElector) renew(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(le.config.RetryPeriod):
+		}
+		err := wait.PollImmediate(le.config.RetryPeriod, le.config.RenewDeadline, func() (bool, error) {
+			return le.tryAcquireOrRenew(), nil
+		})
+		if nil != err {
+			glog.Errorf("Failed to renew lease %s/%s: %v\n", le.config.Namespace, le.config.Name, err)
+			return
+		}
+		glog.V(4).Infof("Successfully renewed lease %s/%s\n", le.config.Namespace, le.config.Name)
+	}
+}
+
+// Acquire or renew the leadership, return whether the candidate is the leader
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	now := unversioned.Now()
+	record := LeaderElectionRecord{
+		HolderIdentity: le.config.Identity,
+		LeaseDurationSeconds: int(le.config.LeaseDuration / time.Second),
+		AcquireTime: now,
+		RenewTime: now,
+	}
+	configMaps := le.config.ConfigMapsGetter.ConfigMaps(le.config.Namespace)
+
+	cm, err := configMaps.Get(le.config.Name)
+	if nil != err {
+		if !errors.IsNotFound(err) {
+			glog.Errorf("Failed to get lock %s/%s: %v\n", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		cm = &apiv1.ConfigMap{
+			ObjectMeta: apiv1.ObjectMeta{Namespace: le.config.Namespace, Name: le.config.Name},
+		}
+		if err := setRecord(cm, record); nil != err {
+			glog.Errorf("Failed to encode leader election record: %#v\n", err)
+			return false
+		}
+		if _, err := configMaps.Create(cm); nil != err {
+			glog.Errorf("Failed to create lock %s/%s: %v\n", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		le.observe(record, now.Time)
+		return true
+	}
+
+	oldRecord := LeaderElectionRecord{}
+	if data, found := cm.Annotations[LeaderElectionRecordAnnotationKey]; found {
+		if err := json.Unmarshal([]byte(data), &oldRecord); nil != err {
+			glog.Errorf("Failed to decode leader election record of %s/%s: %#v\n", le.config.Namespace,
+				le.config.Name, err)
+			return false
+		}
+	}
+	if !reflect.DeepEqual(le.observedRecord, oldRecord) {
+		le.observe(oldRecord, now.Time)
+	}
+	if "" != oldRecord.HolderIdentity && le.config.Identity != oldRecord.HolderIdentity &&
+		le.observedTime.Add(le.config.LeaseDuration).After(now.Time) {
+
+		glog.V(4).Infof("Lease %s/%s is held by %s and has not yet expired\n", le.config.Namespace,
+			le.config.Name, oldRecord.HolderIdentity)
+		return false
+	}
+
+	if le.config.Identity == oldRecord.HolderIdentity {
+		record.AcquireTime = oldRecord.AcquireTime
+		record.LeaderTransitions = oldRecord.LeaderTransitions
+	} else {
+		record.LeaderTransitions = oldRecord.LeaderTransitions + 1
+	}
+	if err := setRecord(cm, record); nil != err {
+		glog.Errorf("Failed to encode leader election record: %#v\n", err)
+		return false
+	}
+	// a conflict means another candidate has written the lock
+	if _, err := configMaps.Update(cm); nil != err {
+		glog.Errorf("Failed to update lock %s/%s: %v\n", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	le.observe(record, now.Time)
+	return true
+}
+
+// Clear the holder of the lock if it is held by the candidate
+func (le *LeaderElector) release() {
+	configMaps := le.config.ConfigMapsGetter.ConfigMaps(le.config.Namespace)
+	cm, err := configMaps.Get(le.config.Name)
+	if nil != err {
+		glog.Errorf("Failed to get lock %s/%s: %v\n", le.config.Namespace, le.config.Name, err)
+		return
+	}
+	record := LeaderElectionRecord{}
+	if err := json.Unmarshal([]byte(cm.Annotations[LeaderElectionRecordAnnotationKey]), &record); nil != err ||
+		le.config.Identity != record.HolderIdentity {
+
+		return
+	}
+	record.HolderIdentity = ""
+	record.RenewTime = unversioned.Now()
+	if err := setRecord(cm, record); nil != err {
+		glog.Errorf("Failed to encode leader election record: %#v\n", err)
+		return
+	}
+	if _, err := configMaps.Update(cm); nil != err {
+		glog.Errorf("Failed to release lock %s/%s: %v\n", le.config.Namespace, le.config.Name, err)
+		return
+	}
+	glog.Infof("Released lease %s/%s\n", le.config.Namespace, le.config.Name)
+}
+
+func (le *LeaderElector) observe(record LeaderElectionRecord, t time.Time) {
+	le.observedRecord = record
+	le.observedTime = t
+}
+
+func setRecord(cm *apiv1.ConfigMap, record LeaderElectionRecord) error {
+	data, err := json.Marshal(record)
+	if nil != err {
+		return err
+	}
+	if nil == cm.Annotations {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Annotations[LeaderElectionRecordAnnotationKey] = string(data)
+	return nil
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"time"
+	"fmt"
+	"encoding/json"
+
+	memhpav1 "memhpa/apis/v1"
+
+	"k8s.io/client-go/1.4/rest"
+	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
+	"k8s.io/client-go/1.4/pkg/api"
+	"k8s.io/client-go/1.4/pkg/util/sets"
+
+	"github.com/golang/glog"
+)
+
+const KubeletBackend = "kubelet"
+
+func init() {
+	RegisterBackend(KubeletBackend, func(opts BackendOptions) (MetricsClient, error) {
+		if nil == opts.RESTClient || nil == opts.PodsGetter {
+			return nil, fmt.Errorf("REST client and pods getter are required by %s backend", KubeletBackend)
+		}
+		return NewKubeletClient(opts.RESTClient, opts.PodsGetter), nil
+	})
+}
+
+// Client to query pod metrics from /stats/summary of kubelets through the API server node proxy
+type KubeletClient struct {
+	restClient *rest.RESTClient
+	podsGetter v1.PodsGetter
+}
+
+func NewKubeletClient(restClient *rest.RESTClient, podsGetter v1.PodsGetter) *KubeletClient {
+	return &KubeletClient{restClient: restClient, podsGetter: podsGetter}
+}
+
+// Subset of kubelet stats/summary
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []containerStats `json:"containers"`
+	} `json:"pods"`
+}
+
+type containerStats struct {
+	Name string `json:"name"`
+	CPU *cpuStats `json:"cpu"`
+	Memory *memoryStats `json:"memory"`
+}
+
+type cpuStats struct {
+	Time time.Time `json:"time"`
+	UsageNanoCores *uint64 `json:"usageNanoCores"`
+}
+
+type memoryStats struct {
+	Time time.Time `json:"time"`
+	UsageBytes *uint64 `json:"usageBytes"`
+	WorkingSetBytes *uint64 `json:"workingSetBytes"`
+	RSSBytes *uint64 `json:"rssBytes"`
+}
+
+func (c *KubeletClient) DefaultMemorySignal() memhpav1.MemorySignal {
+	return memhpav1.MemorySignalUsage
+}
+
+func (c *KubeletClient) GetMemMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	signal := q.Signal
+	if "" == signal {
+		signal = c.DefaultMemorySignal()
+	}
+	if _, found := (&memoryStats{}).value(signal); !found {
+		return nil, time.Time{}, fmt.Errorf("Memory signal %s is not supported by %s backend", signal, KubeletBackend)
+	}
+	return c.getMetric(q, func(ctn *containerStats) (int64, time.Time, bool) {
+		if nil == ctn.Memory {
+			return 0, time.Time{}, false
+		}
+		value, _ := ctn.Memory.value(signal)
+		if nil == value {
+			return 0, time.Time{}, false
+		}
+		return int64(*value), ctn.Memory.Time, true
+	})
+}
+
+// Get CPU usage in millicores
+func (c *KubeletClient) GetCPUMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	return c.getMetric(q, func(ctn *containerStats) (int64, time.Time, bool) {
+		if nil == ctn.CPU || nil == ctn.CPU.UsageNanoCores {
+			return 0, time.Time{}, false
+		}
+		return int64(*ctn.CPU.UsageNanoCores / 1000000), ctn.CPU.Time, true
+	})
+}
+
+func (c *KubeletClient) GetCustomMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	return nil, time.Time{}, fmt.Errorf("Custom queries are not supported by %s backend", KubeletBackend)
+}
+
+// Get metrics of the selected containers of the selected pods. value returns the metric of a container,
+// its timestamp and whether it exists.
+func (c *KubeletClient) getMetric(q MetricsQuery,
+	value func(ctn *containerStats) (int64, time.Time, bool)) (PodResourceInfo, time.Time, error) {
+
+	podsList, err := c.podsGetter.Pods(q.Namespace).List(api.ListOptions{LabelSelector: q.Selector})
+	if nil != err {
+		glog.Errorf("Failed to list pods: %#v\n", err)
+		return nil, time.Time{}, err
+	}
+
+	// nodes where the pods are running
+	nodes := sets.NewString()
+	selected := sets.NewString(q.PodNames...)
+	pods := sets.NewString()
+	for _, p := range podsList.Items {
+		if !selected.Has(p.Name) || "" == p.Spec.NodeName {
+			continue
+		}
+		nodes.Insert(p.Spec.NodeName)
+		pods.Insert(p.Name)
+	}
+
+	info := PodResourceInfo{}
+	var timestamp time.Time
+	for _, node := range nodes.List() {
+		summary, err := c.getSummary(node)
+		if nil != err {
+			// metrics of pods on this node will be treated as missing
+			glog.Errorf("Failed to get stats summary of node %s: %v\n", node, err)
+			continue
+		}
+		for _, p := range summary.Pods {
+			if p.PodRef.Namespace != q.Namespace || !pods.Has(p.PodRef.Name) {
+				continue
+			}
+			for i := range p.Containers {
+				ctn := &p.Containers[i]
+				if !q.ContainerSelected(ctn.Name) {
+					continue
+				}
+				v, t, found := value(ctn)
+				if !found {
+					continue
+				}
+				glog.V(2).Infof("Metric of container %s of pod %s: %v\n", ctn.Name, p.PodRef.Name, v)
+				info.Add(p.PodRef.Name, ctn.Name, v)
+				timestamp = t
+			}
+		}
+	}
+	if 1 > len(info) {
+		return nil, time.Time{}, fmt.Errorf("No metrics was returned from kubelets")
+	}
+	return info, timestamp, nil
+}
+
+// Return value of the signal and whether the signal is supported
+func (m *memoryStats) value(signal memhpav1.MemorySignal) (*uint64, bool) {
+	switch signal {
+	case memhpav1.MemorySignalUsage:
+		return m.UsageBytes, true
+	case memhpav1.MemorySignalWorkingSet:
+		return m.WorkingSetBytes, true
+	case memhpav1.MemorySignalRSS:
+		return m.RSSBytes, true
+	}
+	return nil, false
+}
+
+func (c *KubeletClient) getSummary(node string) (*statsSummary, error) {
+	data, err := c.restClient.Get().
+		AbsPath("/api/v1/nodes", node, "proxy/stats/summary").
+		DoRaw()
+	if nil != err {
+		return nil, err
+	}
+	summary := &statsSummary{}
+	if err := json.Unmarshal(data, summary); nil != err {
+		return nil, fmt.Errorf("unexpected response of stats summary: %v", err)
+	}
+	return summary, nil
+}
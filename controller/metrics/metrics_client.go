@@ -3,78 +3,214 @@ package metrics
 import (
 	"time"
 	"fmt"
-	"context"
+	"sort"
+	"sync"
 
-	"github.com/prometheus/client_golang/api/prometheus"
-	"github.com/prometheus/common/model"
+	memhpav1 "memhpa/apis/v1"
+
+	"k8s.io/client-go/1.4/rest"
+	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
+	"k8s.io/client-go/1.4/pkg/labels"
+	"k8s.io/client-go/1.4/pkg/util/sets"
 
 	"github.com/golang/glog"
 )
 
-type PodResourceInfo map[string]int64
+// Metrics of each container of a pod, keyed by container name.
+// The key is empty if the backend cannot tell the containers apart, e.g. a custom query summing up a pod.
+type ContainerResourceInfo map[string]int64
 
-type MetricsClient interface {
-	GetMemMetric(refNamespace, refName string) (PodResourceInfo, time.Time, error)
+// Metrics of each pod, keyed by pod name
+type PodResourceInfo map[string]ContainerResourceInfo
+
+// Sum up metrics of the containers except the excluded ones
+func (c ContainerResourceInfo) Sum(excluded sets.String) int64 {
+	var sum int64
+	for name, value := range c {
+		if "" != name && excluded.Has(name) {
+			continue
+		}
+		sum += value
+	}
+	return sum
 }
 
-type InClusterPromClient struct {
-	queryAPI prometheus.QueryAPI
+// Add value of the container of the pod
+func (p PodResourceInfo) Add(pod, container string, value int64) {
+	if nil == p[pod] {
+		p[pod] = ContainerResourceInfo{}
+	}
+	p[pod][container] += value
 }
 
-// Get new client to access Prometheus with specified scheme, namsespace, name and port of Prometheus Service in k8s cluster
-func NewInClusterPromClient(scheme, svcNamespace, svcName string, port int) (MetricsClient, error) {
-	promConf := prometheus.Config{
-		Address: fmt.Sprintf("%s://%s.%s:%d", scheme, svcName, svcNamespace, port),
+// A value at a time
+type Sample struct {
+	Timestamp time.Time
+	Value int64
+}
+
+// Samples of a series in time order
+type Samples []Sample
+
+func (s Samples) Len() int           { return len(s) }
+func (s Samples) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s Samples) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
+
+// History of each container of a pod keyed by container name, the key is empty as in ContainerResourceInfo
+type ContainerResourceSeries map[string]Samples
+
+// History of each pod, keyed by pod name
+type PodResourceSeries map[string]ContainerResourceSeries
+
+// Sum up samples of the containers except the excluded ones at each timestamp
+func (c ContainerResourceSeries) Sum(excluded sets.String) Samples {
+	sums := map[int64]int64{}
+	for name, samples := range c {
+		if "" != name && excluded.Has(name) {
+			continue
+		}
+		for _, sample := range samples {
+			sums[sample.Timestamp.UnixNano()] += sample.Value
+		}
 	}
-	client, err := prometheus.New(promConf)
-	if nil != err {
-		glog.Errorf("Failed to init client of Prometheus: %#v\n", client)
-		return nil, err
+	result := make(Samples, 0, len(sums))
+	for nano, value := range sums {
+		result = append(result, Sample{Timestamp: time.Unix(0, nano), Value: value})
 	}
-	return &InClusterPromClient{
-		prometheus.NewQueryAPI(client),
-	}, nil
+	sort.Sort(result)
+	return result
 }
 
-func NewInClusterPromClientOrDie(scheme, svcNamespace, svcName string, port int) MetricsClient {
-	client, err := NewInClusterPromClient(scheme, svcNamespace, svcName, port)
-	if nil != err {
-		panic(err)
+// Add a sample of the container of the pod
+func (p PodResourceSeries) Add(pod, container string, sample Sample) {
+	if nil == p[pod] {
+		p[pod] = ContainerResourceSeries{}
 	}
-	return client
+	p[pod][container] = append(p[pod][container], sample)
 }
 
-func (c *InClusterPromClient) GetMemMetric(refNamespace, refName string) (PodResourceInfo, time.Time, error) {
-	query := fmt.Sprintf(
-		`avg_over_time(
-			container_memory_usage_bytes{
-				namespace="%s",
-				pod_name=~"%s-.*",
-				image!~".*/pause-amd64.*"
-			}[1m]
-		)`, refNamespace, refName)
-	result, err := c.queryAPI.Query(context.Background(), query, time.Now())
-	if nil != err {
-		glog.Errorf("Failed to query Prometheus: %#v\n", err)
-		return nil, time.Time{}, err
-	}
+type MetricsClient interface {
+	// Get memory in bytes
+	GetMemMetric(query MetricsQuery) (PodResourceInfo, time.Time, error)
+	// Get CPU usage in millicores
+	GetCPUMetric(query MetricsQuery) (PodResourceInfo, time.Time, error)
+	// Get metrics with the template of query in milli-units. Backends not supporting queries return an error.
+	GetCustomMetric(query MetricsQuery) (PodResourceInfo, time.Time, error)
+	// Memory signal used if it is not specified in the query
+	DefaultMemorySignal() memhpav1.MemorySignal
+}
+
+// Backends able to evaluate arbitrary queries, e.g. wake queries of scale to zero which don't depend on pods
+type ScalarQuerier interface {
+	// Evaluate the query returning a scalar or a single series, zero if it returns no series
+	QueryScalar(query string) (float64, time.Time, error)
+}
+
+// Backends able to query history of metrics, e.g. to forecast memory
+type RangeQuerier interface {
+	// Get memory in bytes from start to end at the resolution of step
+	GetMemMetricRange(query MetricsQuery, start, end time.Time, step time.Duration) (PodResourceSeries, error)
+}
 
-	info := PodResourceInfo{}
-	switch result.Type() {
-	case model.ValVector:
-		vector := result.(model.Vector)
-		if 1 > len(vector) {
-			return nil, time.Time{}, fmt.Errorf("No metrics was returned from Prometheus")
+// Describe the pods of a scale target whose metrics are queried
+type MetricsQuery struct {
+	Namespace string
+	// Name of the scale target
+	TargetName string
+	// Selector of pods of the scale target
+	Selector labels.Selector
+	// Names of the selected pods. Backends should only return metrics of these pods.
+	PodNames []string
+	// Memory signal to query. The default signal of backend is used if it is empty.
+	Signal memhpav1.MemorySignal
+	// Go template of the query. It is only used by backends which support queries, e.g. Prometheus.
+	// The default template of the backend is used if it is empty.
+	Template string
+	// Only containers with these names are queried if it is not empty
+	IncludeContainers []string
+	// Containers with these names are not queried
+	ExcludeContainers []string
+}
+
+// Return whether metrics of the container should be considered
+func (q *MetricsQuery) ContainerSelected(name string) bool {
+	for _, excluded := range q.ExcludeContainers {
+		if excluded == name {
+			return false
 		}
-		for _, s := range vector  {
-			glog.V(2).Infof("Memory usage of container %s of pod %s: %v\n",
-				s.Metric["container_name"], s.Metric["pod_name"], s.Value)
-			// sum up memory of all containers of each pod
-			info[string(s.Metric["pod_name"])] += int64(s.Value)
+	}
+	if 0 == len(q.IncludeContainers) {
+		return true
+	}
+	for _, included := range q.IncludeContainers {
+		if included == name {
+			return true
 		}
-		return info, vector[0].Timestamp.Time(), nil
-	default:
-		glog.Errorf("Error metrics type: %v\n", result.Type())
-		return nil, time.Time{}, fmt.Errorf("Unexpected metrics type was returned")
 	}
-}
\ No newline at end of file
+	return false
+}
+
+// Options to create a metrics backend. Each backend uses the fields it needs.
+type BackendOptions struct {
+	// Address of Prometheus, e.g. http://prometheus.kube-system:9090
+	PromAddress string
+	// Default Go template of PromQL to query memory of pods
+	PromQueryTemplate string
+	// Label of Prometheus series by which results are grouped into pods
+	PromPodLabel string
+	// Label of Prometheus series by which results of a pod are grouped into containers
+	PromContainerLabel string
+	// REST client of k8s core API, used to access metrics API and kubelets through API server
+	RESTClient *rest.RESTClient
+	PodsGetter v1.PodsGetter
+}
+
+type BackendFactory func(opts BackendOptions) (MetricsClient, error)
+
+var (
+	backendsMutex sync.RWMutex
+	backends = make(map[string]BackendFactory)
+)
+
+// Register a metrics backend with the name. It panics if the name is registered twice.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	if _, found := backends[name]; found {
+		panic(fmt.Sprintf("metrics backend %q was registered twice", name))
+	}
+	backends[name] = factory
+}
+
+// Return names of all registered backends
+func Backends() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create metrics client with the backend registered as name
+func NewBackend(name string, opts BackendOptions) (MetricsClient, error) {
+	backendsMutex.RLock()
+	factory, found := backends[name]
+	backendsMutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("unknown metrics backend %q, available backends: %v", name, Backends())
+	}
+	glog.Infof("Using metrics backend %s\n", name)
+	return factory(opts)
+}
+
+func NewBackendOrDie(name string, opts BackendOptions) MetricsClient {
+	client, err := NewBackend(name, opts)
+	if nil != err {
+		glog.Errorf("Failed to init metrics backend %s: %#v\n", name, err)
+		panic(err)
+	}
+	return client
+}
@@ -0,0 +1,396 @@
+package metrics
+
+import (
+	"time"
+	"fmt"
+	"context"
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	memhpav1 "memhpa/apis/v1"
+
+	"k8s.io/client-go/1.4/pkg/labels"
+	"k8s.io/client-go/1.4/pkg/selection"
+
+	"github.com/prometheus/client_golang/api/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/golang/glog"
+)
+
+const (
+	PromBackend = "prometheus"
+
+	// Labels of cAdvisor series before k8s 1.16. They are "pod" and "container" in newer versions.
+	DefaultPromPodLabel = "pod_name"
+	DefaultPromContainerLabel = "container_name"
+	// Default Go template of PromQL to query memory of each container of the pods.
+	// The value of the signal is the first series in .Series minus the others.
+	// Series of the pod cgroup (empty container) and of the pause container (POD in newer versions) are excluded,
+	// otherwise memory of containers would be counted twice.
+	DefaultPromQueryTemplate = `{{range $i, $series := .Series}}{{if $i}} - {{end}}avg_over_time(
+	{{$series}}{
+		namespace="{{$.Namespace}}",
+		{{$.PodLabel}}=~"{{$.PodRegex}}",
+		{{$.ContainerLabel}}!="",
+		{{$.ContainerLabel}}!="POD",{{with $.ContainerMatchers}}
+		{{.}},{{end}}
+		image!~".*/pause-amd64.*"
+	}[1m]
+){{end}}`
+	// Go template of PromQL to query CPU usage of each container of the pods, in cores
+	DefaultPromCPUQueryTemplate = `rate(
+	container_cpu_usage_seconds_total{
+		namespace="{{.Namespace}}",
+		{{.PodLabel}}=~"{{.PodRegex}}",
+		{{.ContainerLabel}}!="",
+		{{.ContainerLabel}}!="POD",{{with .ContainerMatchers}}
+		{{.}},{{end}}
+		image!~".*/pause-amd64.*"
+	}[1m]
+)`
+)
+
+// cAdvisor series of each memory signal, the value is the first series minus the others
+var signalSeries = map[memhpav1.MemorySignal][]string{
+	memhpav1.MemorySignalUsage: {"container_memory_usage_bytes"},
+	memhpav1.MemorySignalWorkingSet: {"container_memory_working_set_bytes"},
+	memhpav1.MemorySignalRSS: {"container_memory_rss"},
+	memhpav1.MemorySignalUsageWithoutCache: {"container_memory_usage_bytes", "container_memory_cache"},
+}
+
+func init() {
+	RegisterBackend(PromBackend, func(opts BackendOptions) (MetricsClient, error) {
+		return NewPromClient(opts.PromAddress, opts.PromQueryTemplate, opts.PromPodLabel, opts.PromContainerLabel)
+	})
+}
+
+type PromClient struct {
+	queryAPI prometheus.QueryAPI
+	// default templates of memory and CPU queries
+	template *template.Template
+	cpuTemplate *template.Template
+	podLabel model.LabelName
+	containerLabel model.LabelName
+}
+
+// Data to execute query template
+type PromQueryData struct {
+	Namespace string
+	// Name of the scale target
+	TargetName string
+	// Selector of pods of the scale target, e.g. app=foo,tier!=db
+	Selector string
+	// Label of series by which results are grouped into pods
+	PodLabel string
+	// Label of series by which results of a pod are grouped into containers
+	ContainerLabel string
+	// Regex which exactly matches names of the selected pods, e.g. ^(foo-1|foo-2)$
+	PodRegex string
+	// Matchers of the container label to select containers, e.g. container_name!~"^(envoy)$". It may be empty.
+	ContainerMatchers string
+	// Matchers of the selector on labels of kube_pod_labels series, e.g. label_app="foo",label_tier!="db"
+	PodLabelMatchers string
+	// Memory signal to query, e.g. workingSet
+	Signal string
+	// cAdvisor series of the signal. The value of the signal is the first series minus the others.
+	Series []string
+}
+
+// Get new client to access Prometheus with specified scheme, namsespace, name and port of Prometheus Service in k8s cluster
+func NewInClusterPromClient(scheme, svcNamespace, svcName string, port int) (MetricsClient, error) {
+	return NewPromClient(InClusterPromAddress(scheme, svcNamespace, svcName, port), "", "", "")
+}
+
+func NewInClusterPromClientOrDie(scheme, svcNamespace, svcName string, port int) MetricsClient {
+	client, err := NewInClusterPromClient(scheme, svcNamespace, svcName, port)
+	if nil != err {
+		panic(err)
+	}
+	return client
+}
+
+// Return address of Prometheus Service in k8s cluster
+func InClusterPromAddress(scheme, svcNamespace, svcName string, port int) string {
+	return fmt.Sprintf("%s://%s.%s:%d", scheme, svcName, svcNamespace, port)
+}
+
+// Get new client to access Prometheus with the specified address, e.g. http://localhost:9090.
+// queryTemplate is used for MemHpa without its own template, podLabel and containerLabel are the labels to group
+// results by. Defaults are used if they are empty.
+func NewPromClient(address, queryTemplate, podLabel, containerLabel string) (MetricsClient, error) {
+	if "" == queryTemplate {
+		queryTemplate = DefaultPromQueryTemplate
+	}
+	if "" == podLabel {
+		podLabel = DefaultPromPodLabel
+	}
+	if "" == containerLabel {
+		containerLabel = DefaultPromContainerLabel
+	}
+	tmpl, err := template.New("default").Parse(queryTemplate)
+	if nil != err {
+		glog.Errorf("Failed to parse default query template: %#v\n", err)
+		return nil, err
+	}
+	cpuTmpl := template.Must(template.New("cpu").Parse(DefaultPromCPUQueryTemplate))
+
+	promConf := prometheus.Config{
+		Address: address,
+	}
+	client, err := prometheus.New(promConf)
+	if nil != err {
+		glog.Errorf("Failed to init client of Prometheus: %#v\n", client)
+		return nil, err
+	}
+	glog.Infof("Querying Prometheus at %s\n", address)
+	return &PromClient{
+		queryAPI: prometheus.NewQueryAPI(client),
+		template: tmpl,
+		cpuTemplate: cpuTmpl,
+		podLabel: model.LabelName(podLabel),
+		containerLabel: model.LabelName(containerLabel),
+	}, nil
+}
+
+func NewPromClientOrDie(address, queryTemplate, podLabel, containerLabel string) MetricsClient {
+	client, err := NewPromClient(address, queryTemplate, podLabel, containerLabel)
+	if nil != err {
+		panic(err)
+	}
+	return client
+}
+
+func (c *PromClient) DefaultMemorySignal() memhpav1.MemorySignal {
+	return memhpav1.MemorySignalUsage
+}
+
+func (c *PromClient) GetMemMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	return c.queryPods(q, c.template, 1)
+}
+
+// Query CPU usage in millicores
+func (c *PromClient) GetCPUMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	return c.queryPods(q, c.cpuTemplate, 1000)
+}
+
+// Query with the template of query, values are in milli-units
+func (c *PromClient) GetCustomMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	if "" == q.Template {
+		return nil, time.Time{}, fmt.Errorf("Query is required")
+	}
+	return c.queryPods(q, nil, 1000)
+}
+
+// Evaluate the query returning a scalar or a single series. It is zero if no series is returned,
+// e.g. a rate of requests without any request.
+func (c *PromClient) QueryScalar(query string) (float64, time.Time, error) {
+	glog.V(3).Infof("Querying Prometheus: %s\n", query)
+	now := time.Now()
+	result, err := c.queryAPI.Query(context.Background(), query, now)
+	if nil != err {
+		glog.Errorf("Failed to query Prometheus: %#v\n", err)
+		return 0, time.Time{}, err
+	}
+
+	switch result.Type() {
+	case model.ValScalar:
+		scalar := result.(*model.Scalar)
+		return float64(scalar.Value), scalar.Timestamp.Time(), nil
+	case model.ValVector:
+		vector := result.(model.Vector)
+		switch len(vector) {
+		case 0:
+			return 0, now, nil
+		case 1:
+			return float64(vector[0].Value), vector[0].Timestamp.Time(), nil
+		default:
+			return 0, time.Time{}, fmt.Errorf("%d series were returned, aggregate them e.g. by sum()", len(vector))
+		}
+	default:
+		glog.Errorf("Error metrics type: %v\n", result.Type())
+		return 0, time.Time{}, fmt.Errorf("Unexpected metrics type was returned")
+	}
+}
+
+// Query memory of each container of pods from start to end at the resolution of step
+func (c *PromClient) GetMemMetricRange(q MetricsQuery, start, end time.Time,
+	step time.Duration) (PodResourceSeries, error) {
+
+	query, err := c.renderQuery(q, c.template)
+	if nil != err {
+		glog.Errorf("Failed to render query: %#v\n", err)
+		return nil, err
+	}
+	glog.V(3).Infof("Querying Prometheus from %v to %v: %s\n", start, end, query)
+	result, err := c.queryAPI.QueryRange(context.Background(), query,
+		prometheus.Range{Start: start, End: end, Step: step})
+	if nil != err {
+		glog.Errorf("Failed to query Prometheus: %#v\n", err)
+		return nil, err
+	}
+
+	matrix, ok := result.(model.Matrix)
+	if !ok {
+		glog.Errorf("Error metrics type: %v\n", result.Type())
+		return nil, fmt.Errorf("Unexpected metrics type was returned")
+	}
+	series := PodResourceSeries{}
+	for _, stream := range matrix {
+		pod, found := stream.Metric[c.podLabel]
+		if !found {
+			return nil, fmt.Errorf("Label %s was not found in series %v", c.podLabel, stream.Metric)
+		}
+		container := string(stream.Metric[c.containerLabel])
+		if "" != container && !q.ContainerSelected(container) {
+			continue
+		}
+		for _, v := range stream.Values {
+			series.Add(string(pod), container, Sample{Timestamp: v.Timestamp.Time(), Value: int64(v.Value)})
+		}
+	}
+	return series, nil
+}
+
+// Query metrics of each container of pods with the template of query or defaultTemplate,
+// and multiply values by scale
+func (c *PromClient) queryPods(q MetricsQuery, defaultTemplate *template.Template,
+	scale float64) (PodResourceInfo, time.Time, error) {
+
+	query, err := c.renderQuery(q, defaultTemplate)
+	if nil != err {
+		glog.Errorf("Failed to render query: %#v\n", err)
+		return nil, time.Time{}, err
+	}
+	glog.V(3).Infof("Querying Prometheus: %s\n", query)
+	result, err := c.queryAPI.Query(context.Background(), query, time.Now())
+	if nil != err {
+		glog.Errorf("Failed to query Prometheus: %#v\n", err)
+		return nil, time.Time{}, err
+	}
+
+	info := PodResourceInfo{}
+	switch result.Type() {
+	case model.ValVector:
+		vector := result.(model.Vector)
+		if 1 > len(vector) {
+			return nil, time.Time{}, fmt.Errorf("No metrics was returned from Prometheus")
+		}
+		for _, s := range vector  {
+			pod, found := s.Metric[c.podLabel]
+			if !found {
+				return nil, time.Time{}, fmt.Errorf("Label %s was not found in series %v", c.podLabel, s.Metric)
+			}
+			container := string(s.Metric[c.containerLabel])
+			if "" != container && !q.ContainerSelected(container) {
+				// custom query may not select containers
+				continue
+			}
+			glog.V(2).Infof("Value of series %v: %v\n", s.Metric, s.Value)
+			info.Add(string(pod), container, int64(float64(s.Value) * scale))
+		}
+		return info, vector[0].Timestamp.Time(), nil
+	default:
+		glog.Errorf("Error metrics type: %v\n", result.Type())
+		return nil, time.Time{}, fmt.Errorf("Unexpected metrics type was returned")
+	}
+}
+
+// Render PromQL with the template of query or the default template
+func (c *PromClient) renderQuery(q MetricsQuery, defaultTemplate *template.Template) (string, error) {
+	tmpl := defaultTemplate
+	if "" != q.Template {
+		var err error
+		if tmpl, err = template.New("query").Parse(q.Template); nil != err {
+			return "", fmt.Errorf("invalid query template: %v", err)
+		}
+	}
+
+	signal := q.Signal
+	if "" == signal {
+		signal = c.DefaultMemorySignal()
+	}
+	series, found := signalSeries[signal]
+	if !found {
+		return "", fmt.Errorf("unknown memory signal %q", signal)
+	}
+
+	data := PromQueryData{
+		Namespace: q.Namespace,
+		TargetName: q.TargetName,
+		PodLabel: string(c.podLabel),
+		ContainerLabel: string(c.containerLabel),
+		Signal: string(signal),
+		Series: series,
+	}
+	if nil != q.Selector {
+		data.Selector = q.Selector.String()
+		data.PodLabelMatchers = kubePodLabelsMatchers(q.Selector)
+	}
+	data.PodRegex = namesRegex(q.PodNames)
+	data.ContainerMatchers = containerMatchers(string(c.containerLabel), q.IncludeContainers, q.ExcludeContainers)
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); nil != err {
+		return "", fmt.Errorf("failed to execute query template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// Return matchers of the container label to include and exclude containers
+func containerMatchers(label string, included, excluded []string) string {
+	matchers := make([]string, 0, 2)
+	if 0 < len(included) {
+		matchers = append(matchers, fmt.Sprintf(`%s=~"%s"`, label, namesRegex(included)))
+	}
+	if 0 < len(excluded) {
+		matchers = append(matchers, fmt.Sprintf(`%s!~"%s"`, label, namesRegex(excluded)))
+	}
+	return strings.Join(matchers, ",")
+}
+
+// Return a regex matching exactly the names, escaped to be used in a PromQL string
+func namesRegex(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, escapePromString(regexp.QuoteMeta(name)))
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// Convert the selector to matchers on kube_pod_labels of kube-state-metrics, whose labels are
+// pod labels prefixed by "label_" with invalid characters replaced by "_"
+func kubePodLabelsMatchers(selector labels.Selector) string {
+	reqs, selectable := selector.Requirements()
+	if !selectable {
+		return ""
+	}
+	matchers := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		name := "label_" + invalidLabelChars.ReplaceAllString(r.Key(), "_")
+		values := make([]string, 0, r.Values().Len())
+		for _, v := range r.Values().List() {
+			values = append(values, escapePromString(regexp.QuoteMeta(v)))
+		}
+		alternation := "^(" + strings.Join(values, "|") + ")$"
+
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			matchers = append(matchers, fmt.Sprintf(`%s=~"%s"`, name, alternation))
+		case selection.NotEquals, selection.NotIn:
+			matchers = append(matchers, fmt.Sprintf(`%s!~"%s"`, name, alternation))
+		case selection.Exists:
+			matchers = append(matchers, fmt.Sprintf(`%s!=""`, name))
+		case selection.DoesNotExist:
+			matchers = append(matchers, fmt.Sprintf(`%s=""`, name))
+		}
+	}
+	return strings.Join(matchers, ",")
+}
+
+func escapePromString(s string) string {
+	return strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1)
+}
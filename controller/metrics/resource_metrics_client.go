@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"time"
+	"fmt"
+	"encoding/json"
+
+	memhpav1 "memhpa/apis/v1"
+
+	"k8s.io/client-go/1.4/rest"
+	"k8s.io/client-go/1.4/pkg/api/resource"
+	"k8s.io/client-go/1.4/pkg/util/sets"
+
+	"github.com/golang/glog"
+)
+
+const (
+	ResourceMetricsBackend = "resource-metrics"
+
+	resourceMetricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+)
+
+func init() {
+	RegisterBackend(ResourceMetricsBackend, func(opts BackendOptions) (MetricsClient, error) {
+		if nil == opts.RESTClient {
+			return nil, fmt.Errorf("REST client is required by %s backend", ResourceMetricsBackend)
+		}
+		return NewResourceMetricsClient(opts.RESTClient), nil
+	})
+}
+
+// Client to query pod metrics from the resource metrics API (metrics.k8s.io) served by metrics-server
+type ResourceMetricsClient struct {
+	restClient *rest.RESTClient
+}
+
+func NewResourceMetricsClient(restClient *rest.RESTClient) *ResourceMetricsClient {
+	return &ResourceMetricsClient{restClient: restClient}
+}
+
+// Subset of metrics.k8s.io/v1beta1 PodMetricsList
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Timestamp time.Time `json:"timestamp"`
+	Containers []struct {
+		Name string `json:"name"`
+		Usage map[string]resource.Quantity `json:"usage"`
+	} `json:"containers"`
+}
+
+// Memory of resource metrics API is the working set
+func (c *ResourceMetricsClient) DefaultMemorySignal() memhpav1.MemorySignal {
+	return memhpav1.MemorySignalWorkingSet
+}
+
+func (c *ResourceMetricsClient) GetMemMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	if "" != q.Signal && c.DefaultMemorySignal() != q.Signal {
+		return nil, time.Time{}, fmt.Errorf("Memory signal %s is not supported by %s backend",
+			q.Signal, ResourceMetricsBackend)
+	}
+	return c.getMetric(q, "memory", false)
+}
+
+func (c *ResourceMetricsClient) GetCPUMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	return c.getMetric(q, "cpu", true)
+}
+
+func (c *ResourceMetricsClient) GetCustomMetric(q MetricsQuery) (PodResourceInfo, time.Time, error) {
+	return nil, time.Time{}, fmt.Errorf("Custom queries are not supported by %s backend", ResourceMetricsBackend)
+}
+
+// Get usage of the resource of pods, in milli-units if milli is true
+func (c *ResourceMetricsClient) getMetric(q MetricsQuery, resourceName string,
+	milli bool) (PodResourceInfo, time.Time, error) {
+
+	req := c.restClient.Get().
+		AbsPath(resourceMetricsAPIPath, "namespaces", q.Namespace, "pods")
+	if nil != q.Selector {
+		req = req.Param("labelSelector", q.Selector.String())
+	}
+	data, err := req.DoRaw()
+	if nil != err {
+		glog.Errorf("Failed to query resource metrics API: %#v\n", err)
+		return nil, time.Time{}, err
+	}
+
+	list := podMetricsList{}
+	if err := json.Unmarshal(data, &list); nil != err {
+		return nil, time.Time{}, fmt.Errorf("Unexpected response of resource metrics API: %v", err)
+	}
+
+	pods := sets.NewString(q.PodNames...)
+	info := PodResourceInfo{}
+	var timestamp time.Time
+	for _, p := range list.Items {
+		if !pods.Has(p.Metadata.Name) {
+			continue
+		}
+		for _, c := range p.Containers {
+			if !q.ContainerSelected(c.Name) {
+				continue
+			}
+			usage, found := c.Usage[resourceName]
+			if !found {
+				continue
+			}
+			value := usage.Value()
+			if milli {
+				value = usage.MilliValue()
+			}
+			glog.V(2).Infof("Usage of %s of container %s of pod %s: %v\n", resourceName, c.Name, p.Metadata.Name,
+				value)
+			info.Add(p.Metadata.Name, c.Name, value)
+		}
+		timestamp = p.Timestamp
+	}
+	if 1 > len(info) {
+		return nil, time.Time{}, fmt.Errorf("No metrics was returned from resource metrics API")
+	}
+	return info, timestamp, nil
+}
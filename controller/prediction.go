@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"time"
+
+	memhpav1 "memhpa/apis/v1"
+	"memhpa/controller/metrics"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Smoothing factors of Holt's method for the level and the trend
+	holtAlpha = 0.5
+	holtBeta = 0.3
+	// Fewer samples don't tell a trend
+	minPredictionSamples = 3
+)
+
+// Replace metrics of ready pods in info with their forecast by prediction if it is higher, and return whether
+// memory was forecast. Only Memory is forecast, pods with too short history keep their current metrics.
+func (r *ReplicaCalculator) predict(source memhpav1.MetricSourceType, info *podMetricsInfo,
+	query metrics.MetricsQuery, prediction *memhpav1.PredictionSpec) bool {
+
+	if nil == prediction || (memhpav1.MemoryMetricSourceType != source && "" != source) {
+		return false
+	}
+	if nil == r.rangeQuerier {
+		glog.Errorf("Failed to forecast memory: history is not supported without Prometheus\n")
+		return false
+	}
+	horizon, window, step, err := prediction.Parse()
+	if nil != err {
+		glog.Errorf("Failed to forecast memory: %#v\n", err)
+		return false
+	}
+
+	end := info.timestamp
+	if end.IsZero() {
+		end = time.Now()
+	}
+	query.PodNames = make([]string, 0, len(info.metrics))
+	for name := range info.metrics {
+		query.PodNames = append(query.PodNames, name)
+	}
+	history, err := r.rangeQuerier.GetMemMetricRange(query, end.Add(-window), end, step)
+	if nil != err {
+		glog.Errorf("Failed to query history of memory: %#v\n", err)
+		return false
+	}
+
+	at := end.Add(horizon)
+	predicted := make(map[string]int64, len(info.metrics))
+	for name, current := range info.metrics {
+		predicted[name] = current
+		samples := history[name].Sum(info.excluded[name])
+		if len(samples) < minPredictionSamples {
+			glog.V(2).Infof("Skip forecasting memory of pod %s with %d samples\n", name, len(samples))
+			continue
+		}
+		var forecast float64
+		switch prediction.GetMethod() {
+		case memhpav1.HoltPredictionMethod:
+			forecast = holtForecast(samples, step, at)
+		default:
+			forecast = linearForecast(samples, at)
+		}
+		glog.V(2).Infof("Forecast memory of pod %s at %v: %.0f, current: %d\n", name, at, forecast, current)
+		if forecast > float64(current) {
+			predicted[name] = int64(forecast)
+		}
+	}
+	info.metrics = predicted
+	return true
+}
+
+// Fit a least squares line to samples and return its value at the time
+func linearForecast(samples metrics.Samples, at time.Time) float64 {
+	origin := samples[len(samples) - 1].Timestamp
+	n := float64(len(samples))
+	var sumX, sumY, sumXX, sumXY float64
+	for _, s := range samples {
+		x := s.Timestamp.Sub(origin).Seconds()
+		y := float64(s.Value)
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	denominator := n * sumXX - sumX * sumX
+	if 0 == denominator {
+		return sumY / n
+	}
+	slope := (n * sumXY - sumX * sumY) / denominator
+	intercept := (sumY - slope * sumX) / n
+	return intercept + slope * at.Sub(origin).Seconds()
+}
+
+// Smooth the level and the trend per step of samples by Holt's method and return the level projected to the time.
+// Gaps of missing samples are bridged by the trend.
+func holtForecast(samples metrics.Samples, step time.Duration, at time.Time) float64 {
+	steps := func(from, to time.Time) float64 {
+		return to.Sub(from).Seconds() / step.Seconds()
+	}
+
+	level := float64(samples[0].Value)
+	var trend float64
+	if k := steps(samples[0].Timestamp, samples[1].Timestamp); k > 0 {
+		trend = (float64(samples[1].Value) - level) / k
+	}
+	for i := 1; i < len(samples); i++ {
+		k := steps(samples[i - 1].Timestamp, samples[i].Timestamp)
+		if k <= 0 {
+			continue
+		}
+		previous := level
+		level = holtAlpha * float64(samples[i].Value) + (1 - holtAlpha) * (level + k * trend)
+		trend = holtBeta * (level - previous) / k + (1 - holtBeta) * trend
+	}
+	return level + trend * steps(samples[len(samples) - 1].Timestamp, at)
+}
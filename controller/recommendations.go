@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"time"
+)
+
+// Capacity of recommendations kept for each HPA. With the default resync period of 30s,
+// it covers a stabilization window of about an hour.
+const maxRecommendations = 128
+
+type timestampedRecommendation struct {
+	replicas int32
+	timestamp time.Time
+}
+
+// Ring buffer of recent desired replicas recommended for a HPA, the oldest one is overwritten when it is full
+type recommendationBuffer struct {
+	items []timestampedRecommendation
+	// index of the next item to write
+	next int
+}
+
+func newRecommendationBuffer(capacity int) *recommendationBuffer {
+	return &recommendationBuffer{items: make([]timestampedRecommendation, 0, capacity)}
+}
+
+func (b *recommendationBuffer) add(replicas int32, timestamp time.Time) {
+	r := timestampedRecommendation{replicas: replicas, timestamp: timestamp}
+	if len(b.items) < cap(b.items) {
+		b.items = append(b.items, r)
+		return
+	}
+	b.items[b.next] = r
+	b.next = (b.next + 1) % len(b.items)
+}
+
+// Return the max recommendation since the time, and whether the buffer covers the whole period,
+// that is the oldest recommendation was made no later than since
+func (b *recommendationBuffer) maxSince(since time.Time) (int32, bool) {
+	var max int32
+	covered := false
+	for _, r := range b.items {
+		if !r.timestamp.Before(since) && r.replicas > max {
+			max = r.replicas
+		}
+		if !r.timestamp.After(since) {
+			covered = true
+		}
+	}
+	return max, covered
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecommendationBufferMaxSince(t *testing.T) {
+	now := time.Now()
+	at := func(seconds int) time.Time {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	tests := []struct {
+		name string
+		capacity int
+		recommendations []timestampedRecommendation
+		since time.Time
+		expectedMax int32
+		expectedCovered bool
+	}{
+		{"empty", 4, nil, at(-300), 0, false},
+		{"max in the window", 4, []timestampedRecommendation{{5, at(-200)}, {8, at(-100)}, {3, at(0)}},
+			at(-300), 8, false},
+		{"recommendations before the window are ignored but cover it", 4,
+			[]timestampedRecommendation{{9, at(-400)}, {5, at(-200)}, {3, at(0)}}, at(-300), 5, true},
+		{"a recommendation at the start is in the window and covers it", 4,
+			[]timestampedRecommendation{{9, at(-300)}, {3, at(0)}}, at(-300), 9, true},
+		{"overwritten recommendations are dropped", 2,
+			[]timestampedRecommendation{{9, at(-400)}, {7, at(-200)}, {5, at(-100)}, {3, at(0)}}, at(-300), 5, false},
+	}
+	for _, test := range tests {
+		buffer := newRecommendationBuffer(test.capacity)
+		for _, r := range test.recommendations {
+			buffer.add(r.replicas, r.timestamp)
+		}
+		max, covered := buffer.maxSince(test.since)
+		if test.expectedMax != max || test.expectedCovered != covered {
+			t.Errorf("%s: expected %d, %v, got %d, %v", test.name, test.expectedMax, test.expectedCovered, max, covered)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package controller
 
 import (
+	memhpav1 "memhpa/apis/v1"
 	"memhpa/controller/metrics"
 
 	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
-	"k8s.io/client-go/1.4/pkg/labels"
 	apiv1 "k8s.io/client-go/1.4/pkg/api/v1"
 	"k8s.io/client-go/1.4/pkg/api"
+	"k8s.io/client-go/1.4/pkg/api/resource"
 	"k8s.io/client-go/1.4/pkg/util/sets"
 
 	"github.com/golang/glog"
@@ -14,123 +15,318 @@ import (
 	"time"
 	"fmt"
 	"math"
+	"strings"
 )
 
 const tolerance = 0.1
 
 type ReplicaCalculator struct {
 	metricsClient metrics.MetricsClient
+	// evaluates wake queries of scale to zero, it may be nil
+	querier metrics.ScalarQuerier
+	// queries history of memory to forecast, it may be nil
+	rangeQuerier metrics.RangeQuerier
 	podsGetter v1.PodsGetter
 }
 
-func NewReplicaCalculator(mc metrics.MetricsClient, pg v1.PodsGetter) *ReplicaCalculator {
-	return &ReplicaCalculator{metricsClient: mc, podsGetter: pg}
+func NewReplicaCalculator(mc metrics.MetricsClient, querier metrics.ScalarQuerier,
+	rangeQuerier metrics.RangeQuerier, pg v1.PodsGetter) *ReplicaCalculator {
+
+	return &ReplicaCalculator{metricsClient: mc, querier: querier, rangeQuerier: rangeQuerier, podsGetter: pg}
+}
+
+// Return the memory signal to calculate utilization with, or the default signal of metrics client if it is empty
+func (r *ReplicaCalculator) MemorySignal(signal memhpav1.MemorySignal) memhpav1.MemorySignal {
+	if "" == signal {
+		return r.metricsClient.DefaultMemorySignal()
+	}
+	return signal
+}
+
+// Return replicas, utilization, predicted utilization, timestamp, error.
+// Utilization of source (Memory or CPU) is calculated relative to the sum of limits or requests of containers
+// according to base. If skipMissingBase is true, containers without the base are skipped instead of failing
+// the calculation. If prediction is set for Memory, replicas are sized for the forecast and predicted utilization
+// is returned, otherwise it is nil.
+func (r *ReplicaCalculator) GetReplicas(source memhpav1.MetricSourceType, currentReplicas int32,
+	targetUtilization int32, base memhpav1.UtilizationBase, skipMissingBase bool, query metrics.MetricsQuery,
+	prediction *memhpav1.PredictionSpec) (int32, int32, *int32, time.Time, error) {
+
+	nilTime := time.Time{}
+	if "" == base {
+		base = memhpav1.UtilizationBaseLimits
+	}
+	info, err := r.getPodMetrics(source, base, skipMissingBase, query)
+	if nil != err {
+		return 0, 0, nil, nilTime, err
+	}
+
+	glog.V(2).Infof("limits: %v; validMetrics: %v; targetUtilization: %v\n",
+		info.limits, info.metrics, targetUtilization)
+	ratio, utilization, validCount, err := getRatioAndUtilization(info.limits, info.metrics, targetUtilization)
+	if nil != err {
+		if "" == source {
+			source = memhpav1.MemoryMetricSourceType
+		}
+		return 0, 0, nil, nilTime, fmt.Errorf("No containers with a %s base selected: %v",
+			strings.ToLower(string(source)), err)
+	}
+	var predictedUtilization *int32
+	if r.predict(source, info, query, prediction) {
+		glog.V(2).Infof("limits: %v; predictedMetrics: %v; targetUtilization: %v\n",
+			info.limits, info.metrics, targetUtilization)
+		var predicted int32
+		ratio, predicted, validCount, _ = getRatioAndUtilization(info.limits, info.metrics, targetUtilization)
+		predictedUtilization = &predicted
+	}
+
+	replicas := rebalance(currentReplicas, info, ratio, validCount,
+		func(name string) int64 {
+			// set metrics the limit setting to see whether it should still be scaled down
+			return info.limits[name]
+		},
+		func() (float64, int32) {
+			glog.V(2).Infof("limits: %v; rebalanced validMetrics: %v; targetUtilization: %v\n",
+				info.limits, info.metrics, targetUtilization)
+			// the same pods or more are counted, so the sum of their bases is still positive
+			rebalancedRatio, _, validCount, _ := getRatioAndUtilization(info.limits, info.metrics, targetUtilization)
+			return rebalancedRatio, validCount
+		})
+	return replicas, utilization, predictedUtilization, info.timestamp, nil
 }
 
-// return replicas, utilization, timestamp, error
-func (r *ReplicaCalculator) GetReplicas(currentReplicas int32, targetUtilization int32, namespace, name string,
-	selector labels.Selector) (int32, int32, time.Time, error) {
+// Return replicas, average value of metrics of source per pod, predicted average value, timestamp, error.
+// Desired replicas is the sum of metrics divided by the target average value.
+// Values are in bytes for Memory and in milli-units for CPU and Prometheus.
+// If prediction is set for Memory, replicas are sized for the forecast and predicted average value is returned,
+// otherwise it is nil.
+func (r *ReplicaCalculator) GetAverageValueReplicas(source memhpav1.MetricSourceType, currentReplicas int32,
+	targetAverageValue int64, query metrics.MetricsQuery,
+	prediction *memhpav1.PredictionSpec) (int32, int64, *int64, time.Time, error) {
 
 	nilTime := time.Time{}
-	metrics, time, err := r.metricsClient.GetMemMetric(namespace, name)
+	info, err := r.getPodMetrics(source, "", false, query)
 	if nil != err {
-		glog.Errorf("Failed to get memory metrics: %#v\n", err)
-		return 0, 0, nilTime, fmt.Errorf("Get metrics error")
+		return 0, 0, nil, nilTime, err
+	}
+
+	glog.V(2).Infof("validMetrics: %v; targetAverageValue: %v\n", info.metrics, targetAverageValue)
+	ratio, averageValue, validCount := getRatioAndAverageValue(info.limits, info.metrics, targetAverageValue)
+	var predictedAverageValue *int64
+	if r.predict(source, info, query, prediction) {
+		glog.V(2).Infof("predictedMetrics: %v; targetAverageValue: %v\n", info.metrics, targetAverageValue)
+		var predicted int64
+		ratio, predicted, validCount = getRatioAndAverageValue(info.limits, info.metrics, targetAverageValue)
+		predictedAverageValue = &predicted
+	}
+
+	replicas := rebalance(currentReplicas, info, ratio, validCount,
+		func(name string) int64 {
+			// set metrics the target to see whether it should still be scaled down
+			return targetAverageValue
+		},
+		func() (float64, int32) {
+			glog.V(2).Infof("rebalanced validMetrics: %v; targetAverageValue: %v\n", info.metrics, targetAverageValue)
+			rebalancedRatio, _, validCount := getRatioAndAverageValue(info.limits, info.metrics, targetAverageValue)
+			return rebalancedRatio, validCount
+		})
+	return replicas, averageValue, predictedAverageValue, info.timestamp, nil
+}
+
+// Return total memory in bytes of ready pods, timestamp, error.
+// It fails if metrics of any ready pod are missing, since the total would be underestimated.
+func (r *ReplicaCalculator) GetTotalMemory(query metrics.MetricsQuery) (int64, time.Time, error) {
+	info, err := r.getPodMetrics(memhpav1.MemoryMetricSourceType, "", false, query)
+	if nil != err {
+		return 0, time.Time{}, err
+	}
+	if 0 < info.missingPods.Len() {
+		return 0, time.Time{}, fmt.Errorf("Metrics of pods %v are missing", info.missingPods.List())
+	}
+	var total int64
+	for _, value := range info.metrics {
+		total += value
+	}
+	return total, info.timestamp, nil
+}
+
+// Evaluate the query returning a scalar or a single series
+func (r *ReplicaCalculator) QueryScalar(query string) (float64, time.Time, error) {
+	if nil == r.querier {
+		return 0, time.Time{}, fmt.Errorf("Queries are not supported without Prometheus")
+	}
+	return r.querier.QueryScalar(query)
+}
+
+// Metrics of pods of a scale target
+type podMetricsInfo struct {
+	// sum of limits or requests of each pod, 0 if base is not required
+	limits map[string]int64
+	// metrics of ready pods
+	metrics map[string]int64
+	unreadyPods sets.String
+	missingPods sets.String // pods without metrics
+	// containers of each pod not considered, since they are not selected or without the base
+	excluded map[string]sets.String
+	timestamp time.Time
+}
+
+// List pods and get their metrics of source. If base is empty, limits or requests of pods are not required.
+func (r *ReplicaCalculator) getPodMetrics(source memhpav1.MetricSourceType, base memhpav1.UtilizationBase,
+	skipMissingBase bool, query metrics.MetricsQuery) (*podMetricsInfo, error) {
+
+	var getMetric func(metrics.MetricsQuery) (metrics.PodResourceInfo, time.Time, error)
+	var resourceName apiv1.ResourceName
+	switch source {
+	case memhpav1.MemoryMetricSourceType, "":
+		getMetric, resourceName = r.metricsClient.GetMemMetric, apiv1.ResourceMemory
+	case memhpav1.CPUMetricSourceType:
+		getMetric, resourceName = r.metricsClient.GetCPUMetric, apiv1.ResourceCPU
+	case memhpav1.PrometheusMetricSourceType:
+		if "" != base {
+			return nil, fmt.Errorf("Utilization is not supported by %s metrics", source)
+		}
+		getMetric = r.metricsClient.GetCustomMetric
+	default:
+		return nil, fmt.Errorf("Unknown metric type %s", source)
 	}
 
-	podsList, err := r.podsGetter.Pods(namespace).List(api.ListOptions{LabelSelector: selector})
+	podsList, err := r.podsGetter.Pods(query.Namespace).List(api.ListOptions{LabelSelector: query.Selector})
 	if nil != err {
 		glog.Errorf("Failed to list pods: %#v\n", err)
-		return 0, 0, nilTime, fmt.Errorf("List pods error")
+		return nil, fmt.Errorf("List pods error")
 	}
 
 	if 1 > len(podsList.Items) {
-		return 0, 0, nilTime, fmt.Errorf("No pods found")
+		return nil, fmt.Errorf("No pods found")
 	}
 
-	limits := make(map[string]int64, len(podsList.Items))
-	// Because metrics could contain pods of other pod controllers with similar name,
-	// so validMetrics is used to filter metrics of invalid pods.
-	validMetrics := make(map[string]int64)
-	unreadyPods := sets.NewString()
-	missingPods := sets.NewString() // pods without metrics
+	// query metrics of exactly the selected pods
+	query.PodNames = make([]string, 0, len(podsList.Items))
+	for _, p := range podsList.Items {
+		query.PodNames = append(query.PodNames, p.Name)
+	}
+	metrics, timestamp, err := getMetric(query)
+	if nil != err {
+		glog.Errorf("Failed to get %s metrics: %#v\n", source, err)
+		return nil, fmt.Errorf("Get metrics error")
+	}
+
+	info := &podMetricsInfo{
+		limits: make(map[string]int64, len(podsList.Items)),
+		// Custom queries could still return pods which are not selected,
+		// so metrics only contains metrics of valid pods.
+		metrics: make(map[string]int64),
+		unreadyPods: sets.NewString(),
+		missingPods: sets.NewString(),
+		excluded: make(map[string]sets.String, len(podsList.Items)),
+		timestamp: timestamp,
+	}
 
 	for _, p := range podsList.Items {
 		var sum int64
+		var selected int
+		excluded := sets.NewString() // containers not selected or without the base
 		for _, c := range p.Spec.Containers {
-			limit, found := c.Resources.Limits[apiv1.ResourceMemory]
-			if !found {
-				return 0, 0, nilTime, fmt.Errorf("Memory limit was not set of container %s", c.Name)
+			if !query.ContainerSelected(c.Name) {
+				excluded.Insert(c.Name)
+				continue
+			}
+			if "" != base {
+				value, found := getContainerBase(&c, resourceName, base)
+				if !found {
+					if skipMissingBase {
+						excluded.Insert(c.Name)
+						continue
+					}
+					return nil, fmt.Errorf("%s %s was not set of container %s", resourceName, base, c.Name)
+				}
+				sum += value
 			}
-			sum += limit.Value()
+			selected++
 		}
-		limits[p.Name] = sum
+		if 0 == selected {
+			glog.V(2).Infof("Skip pod %s because none of its containers is selected or has %s %s\n",
+				p.Name, resourceName, base)
+			continue
+		}
+		info.limits[p.Name] = sum
+		info.excluded[p.Name] = excluded
 
 		// remove metrics of pods that are not running
 		if p.Status.Phase != apiv1.PodRunning || !isPodReady(&p) {
-			unreadyPods.Insert(p.Name)
+			info.unreadyPods.Insert(p.Name)
 			continue
 		}
 
-		m, found := metrics[p.Name]
+		containerMetrics, found := metrics[p.Name]
 		if !found {
-			missingPods.Insert(p.Name)
+			info.missingPods.Insert(p.Name)
 			continue
 		}
-		validMetrics[p.Name] = m
+		info.metrics[p.Name] = containerMetrics.Sum(excluded)
 	}
 
-	if 1 > len(validMetrics) {
-		return 0, 0, nilTime, fmt.Errorf("No valid metrics found")
+	if 1 > len(info.limits) {
+		if "" == base {
+			return nil, fmt.Errorf("No containers of pods are selected")
+		}
+		return nil, fmt.Errorf("%s %s was not set of any selected container", resourceName, base)
 	}
-	glog.V(2).Infof("limits: %v; validMetrics: %v; targetUtilization: %v\n",
-		limits, validMetrics, targetUtilization)
-	ratio, utilization, validCount := getRatioAndUtilization(limits, validMetrics, targetUtilization)
+	if 1 > len(info.metrics) {
+		return nil, fmt.Errorf("No valid metrics found")
+	}
+	return info, nil
+}
+
+// Return desired replicas according to ratio of metrics to target.
+// If metrics of some pods are missing or some pods are not ready, ratio is recalculated by recalculate()
+// after their metrics are rebalanced: missing metrics are set to 0 for scaling up and missingValue() for
+// scaling down; metrics of unready pods are set to 0 for scaling up.
+func rebalance(currentReplicas int32, info *podMetricsInfo, ratio float64, validCount int32,
+	missingValue func(name string) int64, recalculate func() (float64, int32)) int32 {
 
-	rebalanceUnready := unreadyPods.Len() > 0 && ratio > 1.0
-	if !rebalanceUnready && missingPods.Len() == 0 {
+	rebalanceUnready := info.unreadyPods.Len() > 0 && ratio > 1.0
+	if !rebalanceUnready && info.missingPods.Len() == 0 {
 		glog.V(2).Infoln("There is no need to rebalance")
 		if isChangeSmall(ratio) {
-			return currentReplicas, utilization, time, nil
+			return currentReplicas
 		}
 		// calculate desired replicas
-		return calculateReplicas(ratio, validCount), utilization, time, nil
+		return calculateReplicas(ratio, validCount)
 	}
 
-	if missingPods.Len() > 0 {
-		glog.V(2).Infof("Missing metrics of pods %v\n", missingPods)
+	if info.missingPods.Len() > 0 {
+		glog.V(2).Infof("Missing metrics of pods %v\n", info.missingPods)
 		// if some metrics are missed
 		if ratio > 1.0 {
-			for name := range missingPods{
+			for name := range info.missingPods {
 				// set metrics 0 to see whether it should still be scaled up
-				validMetrics[name] = 0
+				info.metrics[name] = 0
 			}
 		} else if ratio < 1.0 {
-			for name := range missingPods {
-				// set metrics the limit setting to see whether it should still be scaled down
-				validMetrics[name] = limits[name]
+			for name := range info.missingPods {
+				info.metrics[name] = missingValue(name)
 			}
 		}
 	}
 
 	if rebalanceUnready {
-		glog.V(2).Infof("Rebalance pods %v\n", unreadyPods)
-		for name := range unreadyPods {
+		glog.V(2).Infof("Rebalance pods %v\n", info.unreadyPods)
+		for name := range info.unreadyPods {
 			// set metrics to be 0 to see whether it should still be scaled up
-			validMetrics[name] = 0
+			info.metrics[name] = 0
 		}
 	}
 
-	glog.V(2).Infof("limits: %v; rebalanced validMetrics: %v; targetUtilization: %v\n",
-		limits, validMetrics, targetUtilization)
-	rebalancedRatio, _, validCount := getRatioAndUtilization(limits, validMetrics, targetUtilization)
+	rebalancedRatio, validCount := recalculate()
 	if isChangeSmall(rebalancedRatio) || (ratio > 1.0 && rebalancedRatio < 1.0) ||
 		(ratio < 1.0 && rebalancedRatio > 1.0) {
 
 		// return current replicas if change is still small or scale direction is changed after rebalance
-		return currentReplicas, utilization, time, nil
+		return currentReplicas
 	}
-	return calculateReplicas(rebalancedRatio, validCount), utilization, time, nil
+	return calculateReplicas(rebalancedRatio, validCount)
 }
 
 func calculateReplicas(ratio float64, replicas int32) int32 {
@@ -143,6 +339,32 @@ func isChangeSmall(ratio float64) bool {
 	return math.Abs(1.0 - ratio) <= tolerance
 }
 
+// Return limit or request of the resource of the container according to base and whether it is set.
+// Memory is in bytes and CPU is in millicores, the same as metrics.
+func getContainerBase(c *apiv1.Container, resourceName apiv1.ResourceName,
+	base memhpav1.UtilizationBase) (int64, bool) {
+
+	limit, limitFound := c.Resources.Limits[resourceName]
+	request, requestFound := c.Resources.Requests[resourceName]
+	value := func(q resource.Quantity) int64 {
+		if apiv1.ResourceCPU == resourceName {
+			return q.MilliValue()
+		}
+		return q.Value()
+	}
+	switch base {
+	case memhpav1.UtilizationBaseRequests:
+		return value(request), requestFound
+	case memhpav1.UtilizationBaseLimitsOrRequests:
+		if limitFound {
+			return value(limit), true
+		}
+		return value(request), requestFound
+	default:
+		return value(limit), limitFound
+	}
+}
+
 func isPodReady(pod *apiv1.Pod) bool {
 	for _, c := range pod.Status.Conditions {
 		if c.Type == apiv1.PodReady && c.Status == apiv1.ConditionTrue {
@@ -152,7 +374,9 @@ func isPodReady(pod *apiv1.Pod) bool {
 	return false
 }
 
-func getRatioAndUtilization(limits, metrics map[string]int64, target int32) (float64, int32, int32) {
+// Return ratio of utilization to target, utilization and count of pods with metrics.
+// It fails if the sum of bases of the pods is zero, e.g. limits of all selected containers are explicitly 0.
+func getRatioAndUtilization(limits, metrics map[string]int64, target int32) (float64, int32, int32, error) {
 	var limitsTotal, metricsTotal int64
 	var validCount int32
 	for name, m := range metrics {
@@ -166,7 +390,26 @@ func getRatioAndUtilization(limits, metrics map[string]int64, target int32) (flo
 		validCount++
 	}
 
+	if 0 == limitsTotal {
+		return 0, 0, validCount, fmt.Errorf("the sum of their bases is zero")
+	}
 	utilization := int32((metricsTotal * 100) / limitsTotal)
 	glog.V(2).Infof("utilization: %d, validCount: %d", utilization, validCount)
-	return float64(utilization) / float64(target), utilization, validCount
-}
\ No newline at end of file
+	return float64(utilization) / float64(target), utilization, validCount, nil
+}
+func getRatioAndAverageValue(limits, metrics map[string]int64, target int64) (float64, int64, int32) {
+	var metricsTotal int64
+	var validCount int32
+	for name, m := range metrics {
+		if _, found := limits[name]; !found {
+			// filter value which not in limits
+			continue
+		}
+		metricsTotal += m
+		validCount++
+	}
+
+	averageValue := metricsTotal / int64(validCount)
+	glog.V(2).Infof("averageValue: %d, validCount: %d", averageValue, validCount)
+	return float64(metricsTotal) / float64(validCount) / float64(target), averageValue, validCount
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	memhpav1 "memhpa/apis/v1"
+	"memhpa/controller/metrics"
+
+	"k8s.io/client-go/1.4/kubernetes/typed/core/v1"
+	"k8s.io/client-go/1.4/pkg/api"
+	"k8s.io/client-go/1.4/pkg/api/resource"
+	apiv1 "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+// Pods getter listing the same pods in any namespace, the other methods are not implemented
+type fakePods struct {
+	v1.PodInterface
+	pods []apiv1.Pod
+}
+
+func (f *fakePods) Pods(namespace string) v1.PodInterface {
+	return f
+}
+
+func (f *fakePods) List(opts api.ListOptions) (*apiv1.PodList, error) {
+	return &apiv1.PodList{Items: f.pods}, nil
+}
+
+// Metrics client returning the same memory metrics for any query
+type fakeMetrics struct {
+	memory metrics.PodResourceInfo
+}
+
+func (f *fakeMetrics) GetMemMetric(query metrics.MetricsQuery) (metrics.PodResourceInfo, time.Time, error) {
+	return f.memory, time.Now(), nil
+}
+
+func (f *fakeMetrics) GetCPUMetric(query metrics.MetricsQuery) (metrics.PodResourceInfo, time.Time, error) {
+	return f.memory, time.Now(), nil
+}
+
+func (f *fakeMetrics) GetCustomMetric(query metrics.MetricsQuery) (metrics.PodResourceInfo, time.Time, error) {
+	return f.memory, time.Now(), nil
+}
+
+func (f *fakeMetrics) DefaultMemorySignal() memhpav1.MemorySignal {
+	return memhpav1.MemorySignalWorkingSet
+}
+
+// Return a ready pod with a container of the memory limit
+func readyPod(name, limit string) apiv1.Pod {
+	pod := apiv1.Pod{
+		ObjectMeta: apiv1.ObjectMeta{Name: name},
+		Spec: apiv1.PodSpec{Containers: []apiv1.Container{{Name: "app"}}},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			Conditions: []apiv1.PodCondition{{Type: apiv1.PodReady, Status: apiv1.ConditionTrue}},
+		},
+	}
+	if "" != limit {
+		pod.Spec.Containers[0].Resources.Limits = apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse(limit)}
+	}
+	return pod
+}
+
+func TestGetRatioAndUtilization(t *testing.T) {
+	tests := []struct {
+		name string
+		limits map[string]int64
+		metrics map[string]int64
+		expectedUtilization int32
+		expectedCount int32
+		expectedErr bool
+	}{
+		{"utilization", map[string]int64{"a": 100, "b": 100}, map[string]int64{"a": 50, "b": 110}, 80, 2, false},
+		{"pods without metrics are not counted", map[string]int64{"a": 100, "b": 300}, map[string]int64{"a": 50},
+			50, 1, false},
+		{"zero base of some pods", map[string]int64{"a": 0, "b": 100}, map[string]int64{"a": 50, "b": 50}, 100, 2,
+			false},
+		{"zero base of all pods", map[string]int64{"a": 0, "b": 0}, map[string]int64{"a": 50, "b": 50}, 0, 2, true},
+	}
+	for _, test := range tests {
+		_, utilization, count, err := getRatioAndUtilization(test.limits, test.metrics, 80)
+		if test.expectedErr != (nil != err) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.expectedErr, err)
+			continue
+		}
+		if test.expectedUtilization != utilization || test.expectedCount != count {
+			t.Errorf("%s: expected utilization %d of %d pods, got %d of %d pods", test.name,
+				test.expectedUtilization, test.expectedCount, utilization, count)
+		}
+	}
+}
+
+func TestGetReplicasWithZeroBase(t *testing.T) {
+	tests := []struct {
+		name string
+		pods []apiv1.Pod
+		include []string
+		expectedErr string
+	}{
+		{"explicit zero limits", []apiv1.Pod{readyPod("a", "0"), readyPod("b", "0")}, nil,
+			"No containers with a memory base selected"},
+		{"limits of other pods", []apiv1.Pod{readyPod("a", "0"), readyPod("b", "100Mi")}, nil, ""},
+		{"no containers included", []apiv1.Pod{readyPod("a", "100Mi")}, []string{"sidecar"},
+			"was not set of any selected container"},
+	}
+	memory := metrics.PodResourceInfo{}
+	memory.Add("a", "app", 50 << 20)
+	memory.Add("b", "app", 50 << 20)
+	for _, test := range tests {
+		calculator := NewReplicaCalculator(&fakeMetrics{memory: memory}, nil, nil, &fakePods{pods: test.pods})
+		query := metrics.MetricsQuery{Namespace: "default", IncludeContainers: test.include}
+		_, _, _, _, err := calculator.GetReplicas(memhpav1.MemoryMetricSourceType, 2, 80,
+			memhpav1.UtilizationBaseLimits, false, query, nil)
+		if "" == test.expectedErr {
+			if nil != err {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if nil == err || !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	memhpav1 "memhpa/apis/v1"
+	"memhpa/controller/metrics"
+
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	autoscalingv1 "k8s.io/client-go/1.4/pkg/apis/autoscaling/v1"
+	"k8s.io/client-go/1.4/pkg/labels"
+
+	"github.com/golang/glog"
+)
+
+// Return the query of metrics of pods of the target selected by selector
+func newMetricsQuery(hpa *memhpav1.MemHpa, selector labels.Selector,
+	signal memhpav1.MemorySignal) metrics.MetricsQuery {
+
+	return metrics.MetricsQuery{
+		Namespace: hpa.MetaData.Namespace,
+		TargetName: hpa.Spec.ScaleTargetRef.Name,
+		Selector: selector,
+		Signal: signal,
+		IncludeContainers: hpa.Spec.IncludeContainers,
+		ExcludeContainers: hpa.Spec.ExcludeContainers,
+	}
+}
+
+// Return whether the wake query of scaleToZero is positive
+func (controller *HPAController) shouldWake(hpa *memhpav1.MemHpa) (bool, error) {
+	value, _, err := controller.replicaCalc.QueryScalar(hpa.Spec.ScaleToZero.WakeQuery)
+	if nil != err {
+		return false, err
+	}
+	glog.V(2).Infof("Wake query of mem hpa %s: %v\n", hpaKey(hpa), value)
+	return value > 0, nil
+}
+
+// Track since when the target has been idle in status, and return whether it should be scaled to zero:
+// total memory of its pods has been below idleBelow for idleDuration and the wake query is not positive.
+// The idle state in status is kept if it fails.
+func (controller *HPAController) checkIdle(hpa *memhpav1.MemHpa, scale *autoscalingv1.Scale,
+	status *memhpav1.MemHPAScalerStatus, now time.Time) (bool, error) {
+
+	status.IdleSince = hpa.Status.IdleSince
+	rule := hpa.Spec.ScaleToZero
+	idleDuration, err := rule.GetIdleDuration()
+	if nil != err {
+		return false, err
+	}
+	selector, err := labels.Parse(scale.Status.Selector)
+	if nil != err {
+		return false, fmt.Errorf("invalid selector: %v", err)
+	}
+	total, _, err := controller.replicaCalc.GetTotalMemory(newMetricsQuery(hpa, selector, status.MemorySignal))
+	if nil != err {
+		return false, err
+	}
+	glog.V(2).Infof("Total memory of mem hpa %s: %d, idle below: %d\n", hpaKey(hpa), total, rule.IdleBelow.Value())
+
+	if total >= rule.IdleBelow.Value() {
+		status.IdleSince = nil
+		return false, nil
+	}
+	if nil == status.IdleSince {
+		since := unversioned.NewTime(now)
+		status.IdleSince = &since
+	}
+	if now.Sub(status.IdleSince.Time) < idleDuration {
+		return false, nil
+	}
+	// keep the target up while there is demand
+	wake, err := controller.shouldWake(hpa)
+	if nil != err {
+		return false, err
+	}
+	return !wake, nil
+}
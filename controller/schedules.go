@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"time"
+
+	memhpav1 "memhpa/apis/v1"
+)
+
+// Return the first active schedule at now, nil if none is active, and the next time when any schedule
+// starts or ends, zero if there is none. Invalid schedules are ignored.
+func activeSchedule(schedules []memhpav1.ScheduleSpec, now time.Time) (*memhpav1.ScheduleSpec, time.Time) {
+	var active *memhpav1.ScheduleSpec
+	var boundary time.Time
+	for i := range schedules {
+		schedule, location, duration, err := schedules[i].Parse()
+		if nil != err {
+			continue
+		}
+		local := now.In(location)
+
+		// the first start in (now - duration, ...)
+		start := schedule.Next(local.Add(-duration))
+		next := schedule.Next(local)
+		if !start.IsZero() && !start.After(local) {
+			// the period of the latest start not after now
+			for {
+				following := schedule.Next(start)
+				if following.IsZero() || following.After(local) {
+					break
+				}
+				start = following
+			}
+			if nil == active {
+				active = &schedules[i]
+			}
+			if end := start.Add(duration); next.IsZero() || end.Before(next) {
+				next = end
+			}
+		}
+		if !next.IsZero() && (boundary.IsZero() || next.Before(boundary)) {
+			boundary = next
+		}
+	}
+	return active, boundary
+}
+
+// Override min and max replicas of the HPA in memory with the schedule.
+// Max replicas is raised to min replicas if it is less.
+func applySchedule(hpa *memhpav1.MemHpa, schedule *memhpav1.ScheduleSpec) {
+	if nil != schedule.MinReplicas {
+		minReplicas := *schedule.MinReplicas
+		hpa.Spec.MinReplicas = &minReplicas
+	}
+	if nil != schedule.MaxReplicas {
+		hpa.Spec.MaxReplicas = *schedule.MaxReplicas
+	}
+	if nil != hpa.Spec.MinReplicas && hpa.Spec.MaxReplicas < *hpa.Spec.MinReplicas {
+		hpa.Spec.MaxReplicas = *hpa.Spec.MinReplicas
+	}
+}
+
+// Reconcile the HPA at the time, unless it is already requeued at the same time
+func (controller *HPAController) requeueAt(key string, t time.Time) {
+	controller.requeuesLock.Lock()
+	defer controller.requeuesLock.Unlock()
+	if pending, found := controller.requeues[key]; found && pending.Equal(t) {
+		return
+	}
+	controller.requeues[key] = t
+	controller.queue.AddAfter(key, t.Sub(time.Now()))
+}
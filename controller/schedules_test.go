@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	memhpav1 "memhpa/apis/v1"
+)
+
+func TestActiveSchedule(t *testing.T) {
+	at := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", value)
+		return t
+	}
+	daily := memhpav1.ScheduleSpec{Name: "daily", Schedule: "0 10 * * *", Duration: "1h"}
+	hourly := memhpav1.ScheduleSpec{Name: "hourly", Schedule: "0 * * * *", Duration: "90m"}
+	weekdays := memhpav1.ScheduleSpec{Name: "weekdays", Schedule: "30 9 * * mon-fri", Duration: "8h"}
+	newYork := memhpav1.ScheduleSpec{Name: "new-york", Schedule: "0 9 * * *", TimeZone: "America/New_York",
+		Duration: "1h"}
+	never := memhpav1.ScheduleSpec{Name: "never", Schedule: "0 0 30 2 *", Duration: "1h"}
+	invalid := memhpav1.ScheduleSpec{Name: "invalid", Schedule: "0 10 * *", Duration: "1h"}
+
+	tests := []struct {
+		name string
+		schedules []memhpav1.ScheduleSpec
+		now time.Time
+		expectedActive string
+		expectedBoundary time.Time
+	}{
+		{"no schedules", nil, at("2026-01-05 10:00"), "", time.Time{}},
+		{"before start", []memhpav1.ScheduleSpec{daily}, at("2026-01-05 09:59"), "", at("2026-01-05 10:00")},
+		{"at start", []memhpav1.ScheduleSpec{daily}, at("2026-01-05 10:00"), "daily", at("2026-01-05 11:00")},
+		{"during the period", []memhpav1.ScheduleSpec{daily}, at("2026-01-05 10:30"), "daily",
+			at("2026-01-05 11:00")},
+		{"at end", []memhpav1.ScheduleSpec{daily}, at("2026-01-05 11:00"), "", at("2026-01-06 10:00")},
+		{"periods longer than the interval", []memhpav1.ScheduleSpec{hourly}, at("2026-01-05 10:45"), "hourly",
+			at("2026-01-05 11:00")},
+		{"end of a long period", []memhpav1.ScheduleSpec{weekdays}, at("2026-01-09 17:29"), "weekdays",
+			at("2026-01-09 17:30")},
+		{"weekend", []memhpav1.ScheduleSpec{weekdays}, at("2026-01-10 10:00"), "", at("2026-01-12 09:30")},
+		{"first active schedule wins", []memhpav1.ScheduleSpec{daily, weekdays}, at("2026-01-05 10:30"), "daily",
+			at("2026-01-05 11:00")},
+		{"earliest boundary of all schedules", []memhpav1.ScheduleSpec{weekdays, daily}, at("2026-01-05 10:30"),
+			"weekdays", at("2026-01-05 11:00")},
+		{"time zone", []memhpav1.ScheduleSpec{newYork}, at("2026-01-05 14:00"), "new-york", at("2026-01-05 15:00")},
+		{"time zone in DST", []memhpav1.ScheduleSpec{newYork}, at("2026-07-06 13:00"), "new-york",
+			at("2026-07-06 14:00")},
+		{"never", []memhpav1.ScheduleSpec{never}, at("2026-01-05 10:00"), "", time.Time{}},
+		{"invalid schedules are ignored", []memhpav1.ScheduleSpec{invalid, daily}, at("2026-01-05 10:30"), "daily",
+			at("2026-01-05 11:00")},
+	}
+	for _, test := range tests {
+		active, boundary := activeSchedule(test.schedules, test.now)
+		name := ""
+		if nil != active {
+			name = active.Name
+		}
+		if test.expectedActive != name || !test.expectedBoundary.Equal(boundary) {
+			t.Errorf("%s: expected %q until %v, got %q until %v", test.name, test.expectedActive,
+				test.expectedBoundary, name, boundary)
+		}
+	}
+}
+
+func TestApplySchedule(t *testing.T) {
+	int32Ptr := func(value int32) *int32 {
+		return &value
+	}
+	tests := []struct {
+		name string
+		schedule memhpav1.ScheduleSpec
+		expectedMin int32
+		expectedMax int32
+	}{
+		{"no overrides", memhpav1.ScheduleSpec{}, 2, 10},
+		{"min replicas", memhpav1.ScheduleSpec{MinReplicas: int32Ptr(5)}, 5, 10},
+		{"max replicas", memhpav1.ScheduleSpec{MaxReplicas: int32Ptr(4)}, 2, 4},
+		{"max replicas raised to min replicas", memhpav1.ScheduleSpec{MinReplicas: int32Ptr(20)}, 20, 20},
+	}
+	for _, test := range tests {
+		hpa := &memhpav1.MemHpa{Spec: memhpav1.MemHPASpec{MinReplicas: int32Ptr(2), MaxReplicas: 10}}
+		applySchedule(hpa, &test.schedule)
+		if test.expectedMin != *hpa.Spec.MinReplicas || test.expectedMax != hpa.Spec.MaxReplicas {
+			t.Errorf("%s: expected %d-%d, got %d-%d", test.name, test.expectedMin, test.expectedMax,
+				*hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package workqueue
+
+import (
+	"sync"
+)
+
+type Interface interface {
+	// Add the key to be processed. It is ignored if the key is already waiting, and is processed again
+	// after Done() if the key is being processed.
+	Add(key string)
+	Len() int
+	// Block until a key can be processed, shutdown is true if the queue is shut down
+	Get() (key string, shutdown bool)
+	// Mark the key done, it must be called after the key returned by Get() is processed
+	Done(key string)
+	// Stop accepting keys and make Get() return shutdown once waiting keys are drained
+	ShutDown()
+	ShuttingDown() bool
+}
+
+// A FIFO queue of keys. A key is never processed concurrently and a waiting key is only queued once.
+type Type struct {
+	// keys in order of processing, each of them is also in dirty and not in processing
+	queue []string
+	// keys which need processing
+	dirty map[string]struct{}
+	// keys being processed, they are added to queue in Done() if they are dirty again
+	processing map[string]struct{}
+
+	cond *sync.Cond
+	shuttingDown bool
+}
+
+func New() *Type {
+	return &Type{
+		dirty: make(map[string]struct{}),
+		processing: make(map[string]struct{}),
+		cond: sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+func (q *Type) Add(key string) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	if _, found := q.dirty[key]; found {
+		return
+	}
+	q.dirty[key] = struct{}{}
+	if _, found := q.processing[key]; found {
+		return
+	}
+	q.queue = append(q.queue, key)
+	q.cond.Signal()
+}
+
+func (q *Type) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return len(q.queue)
+}
+
+func (q *Type) Get() (string, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for 0 == len(q.queue) && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if 0 == len(q.queue) {
+		return "", true
+	}
+
+	key := q.queue[0]
+	q.queue = q.queue[1:]
+	q.processing[key] = struct{}{}
+	delete(q.dirty, key)
+	return key, false
+}
+
+func (q *Type) Done(key string) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, key)
+	if _, found := q.dirty[key]; found {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+func (q *Type) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+func (q *Type) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
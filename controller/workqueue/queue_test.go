@@ -0,0 +1,105 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddDeduplicatesWaitingKeys(t *testing.T) {
+	q := New()
+	q.Add("a")
+	q.Add("b")
+	q.Add("a")
+	if 2 != q.Len() {
+		t.Fatalf("expected 2 waiting keys, got %d", q.Len())
+	}
+	for _, expected := range []string{"a", "b"} {
+		if key, shutdown := q.Get(); expected != key || shutdown {
+			t.Errorf("expected %s, got %s, shutdown %v", expected, key, shutdown)
+		}
+	}
+}
+
+func TestAddDuringProcessing(t *testing.T) {
+	q := New()
+	q.Add("a")
+	key, _ := q.Get()
+
+	// the key is not processed concurrently, it waits for Done()
+	q.Add(key)
+	q.Add(key)
+	if 0 != q.Len() {
+		t.Fatalf("expected no waiting keys while processing, got %d", q.Len())
+	}
+	q.Done(key)
+	if 1 != q.Len() {
+		t.Fatalf("expected the key to be requeued once by Done(), got %d waiting keys", q.Len())
+	}
+	if key, _ := q.Get(); "a" != key {
+		t.Errorf("expected a, got %s", key)
+	}
+	q.Done(key)
+	if 0 != q.Len() {
+		t.Errorf("expected no waiting keys after Done() of a clean key, got %d", q.Len())
+	}
+}
+
+func TestGetBlocksUntilAdd(t *testing.T) {
+	q := New()
+	keys := make(chan string)
+	go func() {
+		key, _ := q.Get()
+		keys <- key
+	}()
+	select {
+	case key := <-keys:
+		t.Fatalf("expected Get() to block, got %s", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.Add("a")
+	select {
+	case key := <-keys:
+		if "a" != key {
+			t.Errorf("expected a, got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Get() is still blocked after Add()")
+	}
+}
+
+func TestShutDownDrainsWaitingKeys(t *testing.T) {
+	q := New()
+	q.Add("a")
+	q.Add("b")
+	q.ShutDown()
+	if !q.ShuttingDown() {
+		t.Fatalf("expected the queue to be shutting down")
+	}
+	q.Add("c")
+	for _, expected := range []string{"a", "b"} {
+		if key, shutdown := q.Get(); expected != key || shutdown {
+			t.Errorf("expected %s before shutdown, got %s, shutdown %v", expected, key, shutdown)
+		}
+	}
+	if key, shutdown := q.Get(); !shutdown {
+		t.Errorf("expected shutdown after draining, got %s", key)
+	}
+}
+
+func TestShutDownWakesBlockedGet(t *testing.T) {
+	q := New()
+	done := make(chan bool)
+	go func() {
+		_, shutdown := q.Get()
+		done <- shutdown
+	}()
+	q.ShutDown()
+	select {
+	case shutdown := <-done:
+		if !shutdown {
+			t.Errorf("expected shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Get() is still blocked after ShutDown()")
+	}
+}
@@ -0,0 +1,82 @@
+package workqueue
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// A queue which requeues keys after a delay, which grows exponentially with failures of the key
+type RateLimitingInterface interface {
+	Interface
+	// Add the key after the delay
+	AddAfter(key string, delay time.Duration)
+	// Add the key after the backoff of its failures, and count a failure
+	AddRateLimited(key string)
+	// Reset failures of the key, it should be called once the key is processed successfully
+	Forget(key string)
+	NumRequeues(key string) int
+}
+
+type rateLimitingType struct {
+	*Type
+
+	baseDelay time.Duration
+	maxDelay time.Duration
+
+	failuresLock sync.Mutex
+	failures map[string]int
+}
+
+// Create a rate limiting queue whose delay is baseDelay * 2^failures, but not more than maxDelay
+func NewRateLimitingQueue(baseDelay, maxDelay time.Duration) RateLimitingInterface {
+	return &rateLimitingType{
+		Type: New(),
+		baseDelay: baseDelay,
+		maxDelay: maxDelay,
+		failures: make(map[string]int),
+	}
+}
+
+func (q *rateLimitingType) AddAfter(key string, delay time.Duration) {
+	if q.ShuttingDown() {
+		return
+	}
+	if delay <= 0 {
+		q.Add(key)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		q.Add(key)
+	})
+}
+
+func (q *rateLimitingType) AddRateLimited(key string) {
+	q.AddAfter(key, q.when(key))
+}
+
+// Return the backoff of the key and count a failure
+func (q *rateLimitingType) when(key string) time.Duration {
+	q.failuresLock.Lock()
+	defer q.failuresLock.Unlock()
+	exp := q.failures[key]
+	q.failures[key]++
+
+	backoff := float64(q.baseDelay) * math.Pow(2, float64(exp))
+	if backoff > float64(q.maxDelay) {
+		return q.maxDelay
+	}
+	return time.Duration(backoff)
+}
+
+func (q *rateLimitingType) Forget(key string) {
+	q.failuresLock.Lock()
+	defer q.failuresLock.Unlock()
+	delete(q.failures, key)
+}
+
+func (q *rateLimitingType) NumRequeues(key string) int {
+	q.failuresLock.Lock()
+	defer q.failuresLock.Unlock()
+	return q.failures[key]
+}
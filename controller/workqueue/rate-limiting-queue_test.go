@@ -0,0 +1,82 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhen(t *testing.T) {
+	q := NewRateLimitingQueue(5 * time.Millisecond, time.Second).(*rateLimitingType)
+	expected := []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		160 * time.Millisecond,
+		320 * time.Millisecond,
+		640 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, delay := range expected {
+		if backoff := q.when("a"); delay != backoff {
+			t.Errorf("failure %d: expected %v, got %v", i, delay, backoff)
+		}
+	}
+	if len(expected) != q.NumRequeues("a") {
+		t.Errorf("expected %d requeues, got %d", len(expected), q.NumRequeues("a"))
+	}
+	if backoff := q.when("b"); 5 * time.Millisecond != backoff {
+		t.Errorf("expected failures to be counted per key, got %v", backoff)
+	}
+
+	q.Forget("a")
+	if 0 != q.NumRequeues("a") {
+		t.Errorf("expected no requeues after Forget(), got %d", q.NumRequeues("a"))
+	}
+	if backoff := q.when("a"); 5 * time.Millisecond != backoff {
+		t.Errorf("expected the base delay after Forget(), got %v", backoff)
+	}
+}
+
+func TestWhenCapsLargeExponents(t *testing.T) {
+	q := NewRateLimitingQueue(time.Millisecond, time.Minute).(*rateLimitingType)
+	q.failures["a"] = 1000
+	if backoff := q.when("a"); time.Minute != backoff {
+		t.Errorf("expected %v, got %v", time.Minute, backoff)
+	}
+}
+
+func TestAddAfter(t *testing.T) {
+	q := NewRateLimitingQueue(time.Millisecond, time.Second)
+	q.AddAfter("a", 0)
+	if 1 != q.Len() {
+		t.Fatalf("expected the key to be added without delay, got %d waiting keys", q.Len())
+	}
+	key, _ := q.Get()
+	q.Done(key)
+
+	q.AddAfter("b", 20 * time.Millisecond)
+	if 0 != q.Len() {
+		t.Fatalf("expected the key to be delayed, got %d waiting keys", q.Len())
+	}
+	start := time.Now()
+	if key, _ := q.Get(); "b" != key {
+		t.Errorf("expected b, got %s", key)
+	}
+	if elapsed := time.Since(start); elapsed < 15 * time.Millisecond {
+		t.Errorf("expected the key after the delay, got it after %v", elapsed)
+	}
+}
+
+func TestAddAfterShutDown(t *testing.T) {
+	q := NewRateLimitingQueue(time.Millisecond, time.Second)
+	q.ShutDown()
+	q.AddAfter("a", 0)
+	q.AddRateLimited("b")
+	time.Sleep(10 * time.Millisecond)
+	if 0 != q.Len() {
+		t.Errorf("expected no keys added after ShutDown(), got %d", q.Len())
+	}
+}
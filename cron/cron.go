@@ -0,0 +1,210 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed cron expression, each field is a bit set of matched values
+type Schedule struct {
+	minute uint64
+	hour uint64
+	dom uint64
+	month uint64
+	dow uint64
+	// whether day of month and day of week are restricted, days matching either of them match if both are
+	domRestricted bool
+	dowRestricted bool
+}
+
+type bounds struct {
+	min, max int
+	names map[string]int
+}
+
+var (
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds = bounds{0, 23, nil}
+	domBounds = bounds{1, 31, nil}
+	monthBounds = bounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is Sunday as well
+	dowBounds = bounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly": "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly": "0 0 * * 0",
+	"@daily": "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly": "0 * * * *",
+}
+
+// Parse a standard cron expression with 5 fields: minute, hour, day of month, month and day of week.
+// Fields support *, values, names of months and days of week, ranges (a-b), lists (a,b) and steps (*/n, a-b/n).
+// Descriptors such as @daily and @hourly are supported as well.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if spec, found := descriptors[strings.ToLower(expr)]; found {
+		expr = spec
+	}
+	fields := strings.Fields(expr)
+	if 5 != len(fields) {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, but got %d", expr, len(fields))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteBounds); nil != err {
+		return nil, fmt.Errorf("invalid minute of %q: %v", expr, err)
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); nil != err {
+		return nil, fmt.Errorf("invalid hour of %q: %v", expr, err)
+	}
+	if s.dom, err = parseField(fields[2], domBounds); nil != err {
+		return nil, fmt.Errorf("invalid day of month of %q: %v", expr, err)
+	}
+	if s.month, err = parseField(fields[3], monthBounds); nil != err {
+		return nil, fmt.Errorf("invalid month of %q: %v", expr, err)
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); nil != err {
+		return nil, fmt.Errorf("invalid day of week of %q: %v", expr, err)
+	}
+	if 0 != s.dow & (1 << 7) {
+		s.dow |= 1
+	}
+	s.domRestricted = !strings.HasPrefix(fields[2], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i + 1:])
+			if nil != err || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", part[i + 1:])
+			}
+			rangePart, step = part[:i], n
+		}
+
+		var start, end int
+		switch {
+		case "*" == rangePart:
+			start, end = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			i := strings.Index(rangePart, "-")
+			var err error
+			if start, err = parseValue(rangePart[:i], b); nil != err {
+				return 0, err
+			}
+			if end, err = parseValue(rangePart[i + 1:], b); nil != err {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			var err error
+			if start, err = parseValue(rangePart, b); nil != err {
+				return 0, err
+			}
+			end = start
+			if step > 1 {
+				// a/n means a-max/n
+				end = b.max
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (int, error) {
+	if v, found := b.names[strings.ToLower(value)]; found {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if nil != err {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// Return the first time matching the schedule after t in the location of t,
+// or zero time if there is none in 5 years (e.g. Feb 30th).
+// Like cron, times skipped by DST don't match, and times repeated by DST match twice.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// start from the next whole minute
+	t = t.Add(time.Minute - time.Duration(t.Second()) * time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+	for 0 == s.month & (1 << uint(t.Month())) {
+		t = startOfDay(t.Year(), t.Month() + 1, 1, loc)
+		if time.January == t.Month() {
+			goto WRAP
+		}
+	}
+	for !s.dayMatches(t) {
+		t = startOfDay(t.Year(), t.Month(), t.Day() + 1, loc)
+		if 1 == t.Day() {
+			goto WRAP
+		}
+	}
+	// hours and minutes are advanced by durations, since time.Date moves back to the previous hour in a DST gap
+	day := t.Day()
+	for 0 == s.hour & (1 << uint(t.Hour())) {
+		t = t.Add(time.Hour - time.Duration(t.Minute()) * time.Minute)
+		if day != t.Day() {
+			goto WRAP
+		}
+	}
+	hour := t.Hour()
+	for 0 == s.minute & (1 << uint(t.Minute())) {
+		t = t.Add(time.Minute)
+		if hour != t.Hour() {
+			goto WRAP
+		}
+	}
+	return t
+}
+
+// Return the first time of the day in the location. time.Date moves midnight skipped by DST
+// (e.g. in America/Santiago) back to the previous day, then the day starts at the end of the gap.
+func startOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	t := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	for t.Day() != date.Day() {
+		t = t.Add(time.Hour - time.Duration(t.Minute()) * time.Minute)
+	}
+	return t
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatched := 0 != s.dom & (1 << uint(t.Day()))
+	dowMatched := 0 != s.dow & (1 << uint(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return domMatched || dowMatched
+	}
+	return domMatched && dowMatched
+}
@@ -0,0 +1,109 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* * * foo *",
+		"* * * * mon-foo",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1,,2 * * * *",
+		"@every",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); nil == err {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if nil != err {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	santiago, err := time.LoadLocation("America/Santiago")
+	if nil != err {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	utc := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", value)
+		return t
+	}
+	in := func(loc *time.Location, value string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04 MST", value, loc)
+		return t
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		expected time.Time
+	}{
+		{"every minute", "* * * * *", utc("2026-01-01 10:00"), utc("2026-01-01 10:01")},
+		{"seconds are truncated", "* * * * *", utc("2026-01-01 10:00").Add(59 * time.Second),
+			utc("2026-01-01 10:01")},
+		{"later today", "30 9 * * *", utc("2026-01-01 08:00"), utc("2026-01-01 09:30")},
+		{"tomorrow", "30 9 * * *", utc("2026-01-01 09:30"), utc("2026-01-02 09:30")},
+		{"next year", "0 0 1 1 *", utc("2026-01-01 00:00"), utc("2027-01-01 00:00")},
+		{"minute step", "*/15 * * * *", utc("2026-01-01 10:16"), utc("2026-01-01 10:30")},
+		{"hour step wraps to the next day", "0 */6 * * *", utc("2026-01-01 18:01"), utc("2026-01-02 00:00")},
+		{"range step", "0 9-17/4 * * *", utc("2026-01-01 13:01"), utc("2026-01-01 17:00")},
+		{"value step", "0 10/5 * * *", utc("2026-01-01 16:00"), utc("2026-01-01 20:00")},
+		{"list", "0 8,12,20 * * *", utc("2026-01-01 12:00"), utc("2026-01-01 20:00")},
+		{"names of days of week", "0 9 * * mon-fri", utc("2026-01-02 10:00"), utc("2026-01-05 09:00")},
+		{"names of months", "0 0 1 JUN,dec *", utc("2026-06-02 00:00"), utc("2026-12-01 00:00")},
+		{"sunday as 7", "0 0 * * 7", utc("2026-01-01 00:00"), utc("2026-01-04 00:00")},
+		{"day of month or day of week", "0 0 13 * fri", utc("2026-01-10 00:00"), utc("2026-01-13 00:00")},
+		{"day of month and any day of week", "0 0 13 * *", utc("2026-01-10 00:00"), utc("2026-01-13 00:00")},
+		{"day of month skips short months", "0 0 31 * *", utc("2026-01-31 00:00"), utc("2026-03-31 00:00")},
+		{"feb 29 in the next leap year", "0 0 29 2 *", utc("2026-01-01 00:00"), utc("2028-02-29 00:00")},
+		{"feb 29 after a leap day", "0 12 29 2 *", utc("2028-02-29 12:00"), utc("2032-02-29 12:00")},
+		{"feb 30 never matches", "0 0 30 2 *", utc("2026-01-01 00:00"), time.Time{}},
+		{"descriptor", "@daily", utc("2026-01-01 10:00"), utc("2026-01-02 00:00")},
+		{"upper case descriptor", "@HOURLY", utc("2026-01-01 10:00"), utc("2026-01-01 11:00")},
+		{"weekly", "@weekly", utc("2026-01-01 10:00"), utc("2026-01-04 00:00")},
+		{"time in a DST gap is skipped", "30 2 * * *", in(ny, "2026-03-08 00:00 EST"),
+			in(ny, "2026-03-09 02:30 EDT")},
+		{"hour after a DST gap", "0 3 * * *", in(ny, "2026-03-08 00:00 EST"), in(ny, "2026-03-08 03:00 EDT")},
+		{"every hour across a DST gap", "0 * * * *", in(ny, "2026-03-08 01:00 EST"),
+			in(ny, "2026-03-08 03:00 EDT")},
+		{"every minute across a DST gap", "* * * * *", in(ny, "2026-03-08 01:59 EST"),
+			in(ny, "2026-03-08 03:00 EDT")},
+		{"first time in a DST overlap", "30 1 * * *", in(ny, "2026-11-01 00:00 EDT"),
+			in(ny, "2026-11-01 01:30 EDT")},
+		{"repeated time in a DST overlap", "30 1 * * *", in(ny, "2026-11-01 01:45 EDT"),
+			in(ny, "2026-11-01 01:30 EST")},
+		{"hour after a DST overlap", "0 2 * * *", in(ny, "2026-11-01 01:30 EDT"), in(ny, "2026-11-01 02:00 EST")},
+		{"midnight skipped by DST", "0 0 * * *", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago),
+			time.Date(2026, 9, 7, 0, 0, 0, 0, santiago)},
+		{"day starting after a DST gap", "0 1 6 9 *", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago),
+			time.Date(2026, 9, 6, 1, 0, 0, 0, santiago)},
+		{"location of the time", "0 9 * * *", in(ny, "2026-01-01 10:00 EST"), in(ny, "2026-01-02 09:00 EST")},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.expr)
+		if nil != err {
+			t.Errorf("%s: failed to parse %q: %v", test.name, test.expr, err)
+			continue
+		}
+		if next := schedule.Next(test.from); !test.expected.Equal(next) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, next)
+		}
+	}
+}
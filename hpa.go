@@ -3,63 +3,256 @@ package main
 import (
 	"github.com/golang/glog"
 
-	"k8s.io/client-go/1.4/rest"
 	"k8s.io/client-go/1.4/kubernetes"
+	"k8s.io/client-go/1.4/pkg/util/uuid"
 
 	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"memhpa/app"
 	"memhpa/client"
 	"memhpa/controller"
+	"memhpa/controller/leaderelection"
 	"memhpa/controller/metrics"
+	"memhpa/monitoring"
+	"memhpa/webhook"
 )
 
 var (
 	stopCh chan struct{}
 
+	master string
+	kubeconfig string
+	kubeContext string
+
+	metricsBackend string
+
+	promURL string
+	promQueryTemplate string
+	promPodLabel string
+	promContainerLabel string
 	promSvcScheme string
 	promSvcNamespace string
 	promSvcName string
 	promSvcPort int
+
+	workers int
+	dryRun bool
+	shutdownTimeout time.Duration
+
+	leaderElect bool
+	leaderElectNamespace string
+	leaderElectName string
+	leaderElectLeaseDuration time.Duration
+	leaderElectRenewDeadline time.Duration
+	leaderElectRetryPeriod time.Duration
+
+	metricsAddr string
+
+	webhookAddr string
+	tlsCertFile string
+	tlsKeyFile string
 )
 
 func init() {
 	stopCh = make(chan struct{})
 
+	flag.StringVar(&master, "master", "",
+		"Address of K8S API server, overrides the server in kubeconfig")
+	flag.StringVar(&kubeconfig, "kubeconfig", "",
+		"Path to a kubeconfig file. In-cluster config is used if neither -master nor -kubeconfig is specified")
+	flag.StringVar(&kubeContext, "context", "", "Context of kubeconfig to use (default current-context)")
+
+	flag.StringVar(&metricsBackend, "metrics-backend", metrics.PromBackend,
+		fmt.Sprintf("Backend to query pod metrics, one of %v", metrics.Backends()))
+
+	flag.StringVar(&promURL, "prom-url", "",
+		"URL of Prometheus, e.g. http://localhost:9090. It overrides -prom-scheme, -prom-namespace, -prom-name and -prom-port")
+	flag.StringVar(&promQueryTemplate, "prom-query-template", metrics.DefaultPromQueryTemplate,
+		"Default Go template of PromQL to query memory of pods, used if .spec.metricQuery of MemHpa is empty")
+	flag.StringVar(&promPodLabel, "prom-pod-label", metrics.DefaultPromPodLabel,
+		"Label of Prometheus series by which query results are grouped into pods")
+	flag.StringVar(&promContainerLabel, "prom-container-label", metrics.DefaultPromContainerLabel,
+		"Label of Prometheus series by which query results of a pod are grouped into containers")
 	flag.StringVar(&promSvcScheme, "prom-scheme", "http", "Scheme of Prometheus service")
 	flag.StringVar(&promSvcNamespace, "prom-namespace", "kube-system",
 		"Namespace of Prometheus service")
 	flag.StringVar(&promSvcName, "prom-name", "prometheus","Name of Prometheus service")
 	flag.IntVar(&promSvcPort, "prom-port", 9090,"Port of Prometheus service")
+
+	flag.IntVar(&workers, "workers", 5, "Number of MemHpa reconciled concurrently")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Compute and publish desired replicas without scaling any target, as if .spec.mode of all MemHpa " +
+		"were RecommendOnly")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 20 * time.Second,
+		"Max duration to wait for in-flight reconciles on SIGTERM or SIGINT")
+
+	flag.BoolVar(&leaderElect, "leader-elect", false,
+		"Elect a leader among replicas of the controller, only the leader scales targets. Enable it when running " +
+		"more than one replica")
+	flag.StringVar(&leaderElectNamespace, "leader-elect-namespace", "kube-system",
+		"Namespace of the ConfigMap used as the leader election lock")
+	flag.StringVar(&leaderElectName, "leader-elect-name", "mem-hpa",
+		"Name of the ConfigMap used as the leader election lock")
+	flag.DurationVar(&leaderElectLeaseDuration, "leader-elect-lease-duration", 15 * time.Second,
+		"Duration that standby replicas wait since the last renewal of the leader before taking over")
+	flag.DurationVar(&leaderElectRenewDeadline, "leader-elect-renew-deadline", 10 * time.Second,
+		"Duration that the leader retries renewing the lease before giving up the leadership")
+	flag.DurationVar(&leaderElectRetryPeriod, "leader-elect-retry-period", 2 * time.Second,
+		"Duration between tries of acquiring and renewing the lease")
+
+	flag.StringVar(&metricsAddr, "metrics-addr", ":8080",
+		"Address to serve metrics of the controller at /metrics in Prometheus format, and health checks at /healthz " +
+		"and /readyz. It is disabled if empty")
+
+	flag.StringVar(&webhookAddr, "webhook-addr", "",
+		"Address to serve the validating (/validate) and mutating (/mutate) admission webhooks over TLS, e.g. :8443. " +
+		"Webhooks are disabled if it is empty")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "Path to the TLS certificate of webhooks")
+	flag.StringVar(&tlsKeyFile, "tls-private-key-file", "", "Path to the TLS private key of webhooks")
 }
 
 func main() {
 	flag.Parse()
+	defer glog.Flush()
+	handleSignals()
 
-	// get in-cluster config
-	config, err := rest.InClusterConfig()
+	// get config to access k8s API
+	config, err := app.BuildConfig(master, kubeconfig, kubeContext)
 	if nil != err {
-		glog.Errorf("Failed to get in-cluster config: %#v\n", err)
+		glog.Errorf("Failed to get k8s config: %#v\n", err)
 		panic(err)
 	}
 
 	// get client set to query k8s resources
 	cs := kubernetes.NewForConfigOrDie(config)
 
-	// create custom resources
-	app.CreateMemHPAResourceGroupOrDie(cs.Extensions())
-
 	// get client to query custom resources
 	scaleClient := client.NewForConfigOrDie(config)
 
-	// get client to query Prometheus
-	metricsClient := metrics.NewInClusterPromClientOrDie(promSvcScheme, promSvcNamespace, promSvcName, promSvcPort)
+	// get client to query metrics
+	promAddress := promURL
+	if "" == promAddress {
+		promAddress = metrics.InClusterPromAddress(promSvcScheme, promSvcNamespace, promSvcName, promSvcPort)
+	}
+	metricsClient := metrics.NewBackendOrDie(metricsBackend, metrics.BackendOptions{
+		PromAddress: promAddress,
+		PromQueryTemplate: promQueryTemplate,
+		PromPodLabel: promPodLabel,
+		PromContainerLabel: promContainerLabel,
+		RESTClient: cs.Core().GetRESTClient(),
+		PodsGetter: cs.Core(),
+	})
+	// wake queries of scale to zero and history of memory to forecast are queried from Prometheus. With other
+	// metrics backends, they are only supported if Prometheus is set explicitly by -prom-url or -prom-* flags.
+	var querier metrics.ScalarQuerier
+	var rangeQuerier metrics.RangeQuerier
+	if promClient, ok := metricsClient.(*metrics.PromClient); ok {
+		querier, rangeQuerier = promClient, promClient
+	} else if isPromSet() {
+		promClient := metrics.NewPromClientOrDie(promAddress, promQueryTemplate, promPodLabel,
+			promContainerLabel).(*metrics.PromClient)
+		querier, rangeQuerier = promClient, promClient
+	} else {
+		glog.Infof("Prometheus is not set, wake queries and prediction are not supported with metrics backend %s\n",
+			metricsBackend)
+	}
+
+	// create controller, it runs only once it is the leader
+	hpaController := controller.NewHPAController(cs.Core(), scaleClient, scaleClient,
+		controller.NewReplicaCalculator(metricsClient, querier, rangeQuerier, cs.Core()), time.Second * 30, dryRun)
+
+	// checks are added before leader election, so that standby replicas are probed with the same checks
+	monitoring.AddHealthzCheck("reconcile", hpaController.CheckReconciles)
+	monitoring.AddHealthzDetail("metrics", hpaController.CheckMetrics)
+	monitoring.AddReadyzCheck("informer-sync", hpaController.CheckSynced)
 
-	// create controller
-	hpaController := controller.NewHPAController(cs.Core(), cs.Extensions(), scaleClient,
-		controller.NewReplicaCalculator(metricsClient, cs.Core()), time.Second * 30)
+	// serve metrics of the controller
+	if "" != metricsAddr {
+		go func() {
+			if err := monitoring.ListenAndServe(metricsAddr, stopCh); nil != err {
+				glog.Errorf("Failed to serve metrics: %#v\n", err)
+				panic(err)
+			}
+		}()
+	}
+
+	// serve admission webhooks
+	if "" != webhookAddr {
+		go func() {
+			if err := webhook.ListenAndServeTLS(webhookAddr, tlsCertFile, tlsKeyFile); nil != err {
+				glog.Errorf("Failed to serve admission webhooks: %#v\n", err)
+				panic(err)
+			}
+		}()
+	}
+
+	run := func(stop <-chan struct{}) {
+		// create custom resources
+		app.CreateMemHPAResourceGroupOrDie(cs.Core().GetRESTClient())
+
+		// run controller
+		hpaController.Run(workers, shutdownTimeout, stop)
+	}
+	if !leaderElect {
+		run(stopCh)
+		return
+	}
+
+	// run controller only if it is the leader
+	hostname, err := os.Hostname()
+	if nil != err {
+		glog.Errorf("Failed to get hostname: %#v\n", err)
+		panic(err)
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.Config{
+		ConfigMapsGetter: cs.Core(),
+		Namespace: leaderElectNamespace,
+		Name: leaderElectName,
+		Identity: hostname + "_" + string(uuid.NewUUID()),
+		LeaseDuration: leaderElectLeaseDuration,
+		RenewDeadline: leaderElectRenewDeadline,
+		RetryPeriod: leaderElectRetryPeriod,
+		OnStartedLeading: run,
+		OnStoppedLeading: func() {
+			// exit to be restarted as a standby, the new leader may already be scaling
+			glog.Fatalf("Lost the leadership of %s/%s\n", leaderElectNamespace, leaderElectName)
+		},
+	})
+	if nil != err {
+		glog.Errorf("Failed to create leader elector: %#v\n", err)
+		panic(err)
+	}
+	elector.Run(stopCh)
+}
+
+// Return whether Prometheus is set explicitly by -prom-url or -prom-* flags of its service
+func isPromSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "prom-url", "prom-scheme", "prom-namespace", "prom-name", "prom-port":
+			set = true
+		}
+	})
+	return set
+}
 
-	// run controller
-	hpaController.Run(stopCh)
+// Close stopCh on SIGTERM or SIGINT to shut down gracefully, exit at once on the second signal
+func handleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		glog.Infof("Received %v, shutting down\n", sig)
+		close(stopCh)
+		sig = <-signals
+		glog.Infof("Received %v again, exiting\n", sig)
+		glog.Flush()
+		os.Exit(1)
+	}()
 }
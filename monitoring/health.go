@@ -0,0 +1,96 @@
+package monitoring
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath = "/readyz"
+)
+
+// A check returns an error if the controller is not healthy or ready
+type Check func() error
+
+type checks struct {
+	lock sync.RWMutex
+	// names in order of adding
+	names []string
+	checks map[string]Check
+	// names of checks whose failures are reported without failing
+	details map[string]bool
+}
+
+var (
+	healthzChecks = &checks{checks: make(map[string]Check), details: make(map[string]bool)}
+	readyzChecks = &checks{checks: make(map[string]Check), details: make(map[string]bool)}
+)
+
+// Add a liveness check, the controller should be restarted if it fails. A check of the same name is replaced.
+func AddHealthzCheck(name string, check Check) {
+	healthzChecks.add(name, check, false)
+}
+
+// Add a check whose failure is reported by /healthz without failing it, e.g. of a dependency which restarting the
+// controller doesn't fix. A check of the same name is replaced.
+func AddHealthzDetail(name string, check Check) {
+	healthzChecks.add(name, check, true)
+}
+
+// Add a readiness check, the controller is not ready if it fails. A check of the same name is replaced.
+func AddReadyzCheck(name string, check Check) {
+	readyzChecks.add(name, check, false)
+}
+
+func (c *checks) add(name string, check Check, detail bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, found := c.checks[name]; !found {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+	c.details[name] = detail
+}
+
+// Run all checks and respond 200 if all of them pass, otherwise 503. The result of each check is written.
+func (c *checks) handler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.lock.RLock()
+		names := append([]string(nil), c.names...)
+		checks := make(map[string]Check, len(c.checks))
+		for name, check := range c.checks {
+			checks[name] = check
+		}
+		details := make(map[string]bool, len(c.details))
+		for name, detail := range c.details {
+			details[name] = detail
+		}
+		c.lock.RUnlock()
+
+		var buf bytes.Buffer
+		failed := false
+		for _, name := range names {
+			if err := checks[name](); nil != err && details[name] {
+				fmt.Fprintf(&buf, "[!]%s warning: %v\n", name, err)
+			} else if nil != err {
+				failed = true
+				fmt.Fprintf(&buf, "[-]%s failed: %v\n", name, err)
+			} else {
+				fmt.Fprintf(&buf, "[+]%s ok\n", name)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if failed {
+			fmt.Fprintf(&buf, "%s check failed\n", path)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			fmt.Fprintf(&buf, "%s check passed\n", path)
+		}
+		w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,54 @@
+package monitoring
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChecksHandler(t *testing.T) {
+	failing := func() error {
+		return fmt.Errorf("failing")
+	}
+	passing := func() error {
+		return nil
+	}
+	tests := []struct {
+		name string
+		add func(c *checks)
+		expectedStatus int
+		expectedLines []string
+	}{
+		{"passing", func(c *checks) {
+			c.add("a", passing, false)
+		}, http.StatusOK, []string{"[+]a ok", "/healthz check passed"}},
+		{"failing", func(c *checks) {
+			c.add("a", passing, false)
+			c.add("b", failing, false)
+		}, http.StatusServiceUnavailable, []string{"[+]a ok", "[-]b failed: failing", "/healthz check failed"}},
+		{"failing detail", func(c *checks) {
+			c.add("a", passing, false)
+			c.add("b", failing, true)
+		}, http.StatusOK, []string{"[+]a ok", "[!]b warning: failing", "/healthz check passed"}},
+		{"detail replaced by check", func(c *checks) {
+			c.add("b", failing, true)
+			c.add("b", failing, false)
+		}, http.StatusServiceUnavailable, []string{"[-]b failed: failing"}},
+	}
+	for _, test := range tests {
+		c := &checks{checks: make(map[string]Check), details: make(map[string]bool)}
+		test.add(c)
+		recorder := httptest.NewRecorder()
+		c.handler(HealthzPath).ServeHTTP(recorder, httptest.NewRequest("GET", HealthzPath, nil))
+		if test.expectedStatus != recorder.Code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expectedStatus, recorder.Code)
+		}
+		for _, line := range test.expectedLines {
+			if !strings.Contains(recorder.Body.String(), line + "\n") {
+				t.Errorf("%s: expected %q in:\n%s", test.name, line, recorder.Body.String())
+			}
+		}
+	}
+}
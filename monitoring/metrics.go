@@ -0,0 +1,114 @@
+package monitoring
+
+import (
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Registry of metrics of the controller, besides metrics of the process and Go runtime
+var DefaultRegistry = prometheus.NewRegistry()
+
+// Directions of scale events
+const (
+	ScaleUp = "up"
+	ScaleDown = "down"
+)
+
+var (
+	CurrentReplicas = newGaugeVec("memhpa_current_replicas",
+		"Current replicas of the target of the MemHpa", "namespace", "name")
+	DesiredReplicas = newGaugeVec("memhpa_desired_replicas",
+		"Desired replicas of the target computed for the MemHpa", "namespace", "name")
+	MinReplicas = newGaugeVec("memhpa_min_replicas",
+		"Min replicas of the MemHpa", "namespace", "name")
+	MaxReplicas = newGaugeVec("memhpa_max_replicas",
+		"Max replicas of the MemHpa", "namespace", "name")
+
+	// Metrics of .spec.metrics are labeled with their index and type
+	CurrentUtilization = newGaugeVec("memhpa_metric_current_utilization_percentage",
+		"Observed utilization of the metric of the MemHpa", "namespace", "name", "index", "type")
+	TargetUtilization = newGaugeVec("memhpa_metric_target_utilization_percentage",
+		"Target utilization of the metric of the MemHpa", "namespace", "name", "index", "type")
+	CurrentAverageValue = newGaugeVec("memhpa_metric_current_average_value",
+		"Observed average value per pod of the metric of the MemHpa, memory in bytes and CPU in cores",
+		"namespace", "name", "index", "type")
+	TargetAverageValue = newGaugeVec("memhpa_metric_target_average_value",
+		"Target average value per pod of the metric of the MemHpa, memory in bytes and CPU in cores",
+		"namespace", "name", "index", "type")
+
+	ReconcileDuration = newHistogramVec("memhpa_reconcile_duration_seconds",
+		"Duration of reconciling the MemHpa", []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		"namespace", "name")
+	MetricFetchErrors = newCounterVec("memhpa_metric_fetch_errors_total",
+		"Failures to fetch metrics of the MemHpa by reason", "namespace", "name", "reason")
+	ScaleEvents = newCounterVec("memhpa_scale_events_total",
+		"Rescales of the target of the MemHpa by direction", "namespace", "name", "direction")
+)
+
+func init() {
+	DefaultRegistry.MustRegister(prometheus.NewProcessCollector(os.Getpid(), ""), prometheus.NewGoCollector())
+}
+
+func newGaugeVec(name, help string, labelNames ...string) *prometheus.GaugeVec {
+	v := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labelNames)
+	DefaultRegistry.MustRegister(v)
+	return v
+}
+
+func newCounterVec(name, help string, labelNames ...string) *prometheus.CounterVec {
+	v := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labelNames)
+	DefaultRegistry.MustRegister(v)
+	return v
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *prometheus.HistogramVec {
+	v := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labelNames)
+	DefaultRegistry.MustRegister(v)
+	return v
+}
+
+// Observe the duration of reconciling the MemHpa since start
+func ObserveReconcile(namespace, name string, start time.Time) {
+	ReconcileDuration.WithLabelValues(namespace, name).Observe(time.Since(start).Seconds())
+}
+
+// Delete all series of the MemHpa
+func DeleteMemHpa(namespace, name string) {
+	for _, v := range []*prometheus.MetricVec{CurrentReplicas.MetricVec, DesiredReplicas.MetricVec,
+		MinReplicas.MetricVec, MaxReplicas.MetricVec, CurrentUtilization.MetricVec, TargetUtilization.MetricVec,
+		CurrentAverageValue.MetricVec, TargetAverageValue.MetricVec, ReconcileDuration.MetricVec,
+		MetricFetchErrors.MetricVec, ScaleEvents.MetricVec} {
+
+		DeleteSeries(v, namespace, name)
+	}
+}
+
+// Delete all series of the vector labeled with the namespace and name of a MemHpa, whatever its other labels are
+func DeleteSeries(v *prometheus.MetricVec, namespace, name string) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		v.Collect(ch)
+		close(ch)
+	}()
+	// deleted after collecting, which locks the vector
+	matched := []prometheus.Labels{}
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); nil != err {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, pair := range m.Label {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if namespace == labels["namespace"] && name == labels["name"] {
+			matched = append(matched, labels)
+		}
+	}
+	for _, labels := range matched {
+		v.Delete(labels)
+	}
+}
@@ -0,0 +1,75 @@
+package monitoring
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Return the number of series of the vector
+func countSeries(v *prometheus.MetricVec) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		v.Collect(ch)
+		close(ch)
+	}()
+	count := 0
+	for range ch {
+		count++
+	}
+	return count
+}
+
+func TestDeleteSeries(t *testing.T) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_replicas", Help: "Replicas."},
+		[]string{"namespace", "name", "kind"})
+	gauge.WithLabelValues("default", "a", "current").Set(1)
+	gauge.WithLabelValues("default", "a", "desired").Set(2)
+	gauge.WithLabelValues("default", "ab", "current").Set(3)
+	gauge.WithLabelValues("other", "a", "current").Set(4)
+	DeleteSeries(gauge.MetricVec, "default", "a")
+
+	if 2 != countSeries(gauge.MetricVec) {
+		t.Errorf("expected 2 series left, got %d", countSeries(gauge.MetricVec))
+	}
+	for _, labelValues := range [][]string{{"default", "ab", "current"}, {"other", "a", "current"}} {
+		if !gauge.DeleteLabelValues(labelValues...) {
+			t.Errorf("expected series %v to be kept", labelValues)
+		}
+	}
+}
+
+func TestDeleteMemHpa(t *testing.T) {
+	CurrentReplicas.WithLabelValues("default", "test").Set(1)
+	CurrentUtilization.WithLabelValues("default", "test", "0", "Memory").Set(50)
+	ScaleEvents.WithLabelValues("default", "test", ScaleUp).Inc()
+	DeleteMemHpa("default", "test")
+
+	for _, v := range []*prometheus.MetricVec{CurrentReplicas.MetricVec, CurrentUtilization.MetricVec,
+		ScaleEvents.MetricVec} {
+
+		if 0 != countSeries(v) {
+			t.Errorf("expected no series left, got %d", countSeries(v))
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	MaxReplicas.WithLabelValues("default", "handler").Set(5)
+	defer DeleteMemHpa("default", "handler")
+
+	recorder := httptest.NewRecorder()
+	NewServeMux().ServeHTTP(recorder, httptest.NewRequest("GET", MetricsPath, nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"# TYPE memhpa_max_replicas gauge\n",
+		`memhpa_max_replicas{name="handler",namespace="default"} 5` + "\n",
+		"# TYPE process_resident_memory_bytes gauge\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in:\n%s", expected, body)
+		}
+	}
+}
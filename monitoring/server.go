@@ -0,0 +1,41 @@
+package monitoring
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const MetricsPath = "/metrics"
+
+// Return a mux serving metrics of DefaultRegistry and health checks
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.HandlerFor(DefaultRegistry, promhttp.HandlerOpts{}))
+	mux.Handle(HealthzPath, healthzChecks.handler(HealthzPath))
+	mux.Handle(ReadyzPath, readyzChecks.handler(ReadyzPath))
+	return mux
+}
+
+// Serve metrics and health checks at the address until stopCh is closed, it returns the error if the server fails
+func ListenAndServe(addr string, stopCh <-chan struct{}) error {
+	glog.Infof("Serving metrics and health checks at %s\n", addr)
+	listener, err := net.Listen("tcp", addr)
+	if nil != err {
+		return err
+	}
+	go func() {
+		<-stopCh
+		listener.Close()
+	}()
+	err = (&http.Server{Handler: NewServeMux()}).Serve(listener)
+	select {
+	case <-stopCh:
+		// closed by stop
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	memhpav1 "memhpa/apis/v1"
+
+	"github.com/golang/glog"
+)
+
+const (
+	ValidatePath = "/validate"
+	MutatePath = "/mutate"
+
+	// API version of responses to reviews without one, responses echo the version of the review otherwise
+	admissionAPIVersion = "admission.k8s.io/v1"
+	jsonPatchType = "JSONPatch"
+)
+
+// Admit the MemHpa of a request and return the response, the UID of which is set by the caller
+type admitFunc func(req *AdmissionRequest, hpa *memhpav1.MemHpa) *AdmissionResponse
+
+// Return the handler of the validating webhook, which denies MemHpa with invalid spec.
+// Defaults are set before validating, since the mutating webhook may not be configured.
+// MemHpa being deleted and updates not changing spec are allowed, so that objects which are already invalid
+// can still be deleted, e.g. by removing their finalizers.
+func NewValidatingHandler() http.Handler {
+	return admissionHandler(func(req *AdmissionRequest, hpa *memhpav1.MemHpa) *AdmissionResponse {
+		if nil != hpa.MetaData.DeletionTimestamp {
+			return &AdmissionResponse{Allowed: true}
+		}
+		if 0 < len(req.OldObject) {
+			unchanged, err := specUnchanged(req.OldObject, hpa)
+			if nil != err {
+				return errorResponse(http.StatusBadRequest, err)
+			}
+			if unchanged {
+				return &AdmissionResponse{Allowed: true}
+			}
+		}
+		memhpav1.SetDefaults(hpa)
+		if errs := memhpav1.Validate(hpa); 0 < len(errs) {
+			messages := make([]string, 0, len(errs))
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			glog.V(2).Infof("Denied %s of mem hpa %s/%s: %v\n", req.Operation, req.Namespace, req.Name, messages)
+			return &AdmissionResponse{
+				Allowed: false,
+				Result: &Status{
+					Code: http.StatusUnprocessableEntity,
+					Message: "invalid MemHpa: " + strings.Join(messages, "; "),
+				},
+			}
+		}
+		return &AdmissionResponse{Allowed: true}
+	})
+}
+
+// Return the handler of the mutating webhook, which sets defaults of unset fields of spec with a JSON patch
+func NewMutatingHandler() http.Handler {
+	return admissionHandler(func(req *AdmissionRequest, hpa *memhpav1.MemHpa) *AdmissionResponse {
+		original := hpa.Spec
+		memhpav1.SetDefaults(hpa)
+		hasSpec, err := hasSpec(req.Object)
+		if nil != err {
+			return errorResponse(http.StatusBadRequest, err)
+		}
+		var patch []PatchOperation
+		if hasSpec {
+			patch, err = specPatch(&original, &hpa.Spec)
+		} else {
+			// fields can't be added to spec which doesn't exist, so add the whole spec
+			patch, err = wholeSpecPatch(&hpa.Spec)
+		}
+		if nil != err {
+			return errorResponse(http.StatusInternalServerError, err)
+		}
+		resp := &AdmissionResponse{Allowed: true}
+		if 0 < len(patch) {
+			data, err := json.Marshal(patch)
+			if nil != err {
+				return errorResponse(http.StatusInternalServerError, err)
+			}
+			patchType := jsonPatchType
+			resp.Patch = data
+			resp.PatchType = &patchType
+		}
+		return resp
+	})
+}
+
+// Return a mux serving both webhooks
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, NewValidatingHandler())
+	mux.Handle(MutatePath, NewMutatingHandler())
+	return mux
+}
+
+// Serve webhooks over TLS at the address, it blocks until the server fails
+func ListenAndServeTLS(addr, certFile, keyFile string) error {
+	glog.Infof("Serving admission webhooks at %s\n", addr)
+	server := &http.Server{Addr: addr, Handler: NewServeMux()}
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+func admissionHandler(admit admitFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodPost != r.Method {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if contentType := r.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+			http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		review := AdmissionReview{}
+		if err := json.Unmarshal(body, &review); nil != err || nil == review.Request {
+			http.Error(w, fmt.Sprintf("invalid AdmissionReview: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		req := review.Request
+		var resp *AdmissionResponse
+		if 0 == len(req.Object) {
+			// e.g. DELETE
+			resp = &AdmissionResponse{Allowed: true}
+		} else {
+			hpa := &memhpav1.MemHpa{}
+			if err := json.Unmarshal(req.Object, hpa); nil != err {
+				resp = errorResponse(http.StatusBadRequest, fmt.Errorf("failed to decode MemHpa: %v", err))
+			} else {
+				resp = admit(req, hpa)
+			}
+		}
+		resp.UID = req.UID
+
+		apiVersion := review.APIVersion
+		if "" == apiVersion {
+			apiVersion = admissionAPIVersion
+		}
+		data, err := json.Marshal(AdmissionReview{
+			APIVersion: apiVersion,
+			Kind: "AdmissionReview",
+			Response: resp,
+		})
+		if nil != err {
+			glog.Errorf("Failed to encode admission response: %#v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
+
+func errorResponse(code int32, err error) *AdmissionResponse {
+	return &AdmissionResponse{
+		Allowed: false,
+		Result: &Status{Code: code, Message: err.Error()},
+	}
+}
+
+// Return JSON patch operations which change the original spec to the modified one.
+// Only top-level fields of spec are compared, which is enough for defaulting.
+func specPatch(original, modified *memhpav1.MemHPASpec) ([]PatchOperation, error) {
+	originalFields, err := toFields(original)
+	if nil != err {
+		return nil, err
+	}
+	modifiedFields, err := toFields(modified)
+	if nil != err {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(modifiedFields))
+	for name := range modifiedFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	patch := []PatchOperation{}
+	for _, name := range names {
+		value := modifiedFields[name]
+		old, found := originalFields[name]
+		if found && string(old) == string(value) {
+			continue
+		}
+		op := "add"
+		if found {
+			op = "replace"
+		}
+		// a pointer since json.RawMessage values are encoded as base64 before Go 1.8
+		patch = append(patch, PatchOperation{Op: op, Path: "/spec/" + escapePointer(name), Value: &value})
+	}
+	return patch, nil
+}
+
+// Return a JSON patch operation which adds the whole spec
+func wholeSpecPatch(spec *memhpav1.MemHPASpec) ([]PatchOperation, error) {
+	data, err := json.Marshal(spec)
+	if nil != err {
+		return nil, err
+	}
+	value := json.RawMessage(data)
+	return []PatchOperation{{Op: "add", Path: "/spec", Value: &value}}, nil
+}
+
+// Return whether the object has a non-null spec
+func hasSpec(object json.RawMessage) (bool, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(object, &fields); nil != err {
+		return false, fmt.Errorf("failed to decode MemHpa: %v", err)
+	}
+	spec, found := fields["spec"]
+	return found && "null" != string(spec), nil
+}
+
+// Return whether spec of the old object equals to the spec of the MemHpa
+func specUnchanged(oldObject json.RawMessage, hpa *memhpav1.MemHpa) (bool, error) {
+	old := &memhpav1.MemHpa{}
+	if err := json.Unmarshal(oldObject, old); nil != err {
+		return false, fmt.Errorf("failed to decode old MemHpa: %v", err)
+	}
+	oldSpec, err := json.Marshal(&old.Spec)
+	if nil != err {
+		return false, err
+	}
+	spec, err := json.Marshal(&hpa.Spec)
+	if nil != err {
+		return false, err
+	}
+	return string(oldSpec) == string(spec), nil
+}
+
+func toFields(spec *memhpav1.MemHPASpec) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(spec)
+	if nil != err {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); nil != err {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Escape a JSON pointer token according to RFC 6901
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
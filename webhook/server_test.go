@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	validSpec = `{"scaleTargetRef": {"kind": "Deployment", "name": "demo"}, "minReplicas": 1, "maxReplicas": 5,
+		"targetUtilizationPercentage": 70, "utilizationBase": "limits", "mode": "Auto"}`
+	invalidSpec = `{"scaleTargetRef": {"kind": "Deployment", "name": "demo"}, "minReplicas": 3, "maxReplicas": 2}`
+	partialSpec = `{"scaleTargetRef": {"kind": "Deployment", "name": "demo"}, "maxReplicas": 5}`
+)
+
+func memHpa(metadata, spec string) string {
+	object := `{"apiVersion": "xinhuang.com/v1", "kind": "MemHpa", "metadata": ` + metadata
+	if "" != spec {
+		object += `, "spec": ` + spec
+	}
+	return object + `}`
+}
+
+func review(apiVersion, operation, object, oldObject string) string {
+	req := `{"uid": "test-uid", "kind": {"group": "xinhuang.com", "version": "v1", "kind": "MemHpa"},
+		"namespace": "default", "name": "demo", "operation": "` + operation + `"`
+	if "" != object {
+		req += `, "object": ` + object
+	}
+	if "" != oldObject {
+		req += `, "oldObject": ` + oldObject
+	}
+	return `{"apiVersion": "` + apiVersion + `", "kind": "AdmissionReview", "request": ` + req + `}}`
+}
+
+func postReview(t *testing.T, url, body string) *AdmissionReview {
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+	if nil != err {
+		t.Fatalf("failed to post review: %v", err)
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	result := &AdmissionReview{}
+	if err := json.NewDecoder(resp.Body).Decode(result); nil != err {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if nil == result.Response {
+		t.Fatalf("response is missing")
+	}
+	return result
+}
+
+func TestValidatingWebhook(t *testing.T) {
+	server := httptest.NewServer(NewServeMux())
+	defer server.Close()
+
+	metadata := `{"name": "demo", "namespace": "default"}`
+	deleting := `{"name": "demo", "namespace": "default", "deletionTimestamp": "2026-01-01T00:00:00Z"}`
+	tests := []struct {
+		name string
+		body string
+		allowed bool
+	}{
+		{"valid create", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, validSpec), ""), true},
+		{"valid create without defaults", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, partialSpec), ""),
+			true},
+		{"invalid create", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, invalidSpec), ""), false},
+		{"create without spec", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, ""), ""), false},
+		{"invalid update", review("admission.k8s.io/v1", "UPDATE", memHpa(metadata, invalidSpec),
+			memHpa(metadata, validSpec)), false},
+		{"update of invalid object without changing spec", review("admission.k8s.io/v1", "UPDATE",
+			memHpa(`{"name": "demo", "namespace": "default", "labels": {"a": "b"}}`, invalidSpec),
+			memHpa(metadata, invalidSpec)), true},
+		{"finalizer removal of invalid object being deleted", review("admission.k8s.io/v1", "UPDATE",
+			memHpa(deleting, invalidSpec), memHpa(`{"name": "demo", "namespace": "default",
+			"deletionTimestamp": "2026-01-01T00:00:00Z", "finalizers": ["test"]}`, invalidSpec)), true},
+		{"delete", review("admission.k8s.io/v1", "DELETE", "", memHpa(metadata, invalidSpec)), true},
+	}
+	for _, test := range tests {
+		result := postReview(t, server.URL + ValidatePath, test.body)
+		if test.allowed != result.Response.Allowed {
+			t.Errorf("%s: expected allowed %v, got %v: %#v", test.name, test.allowed, result.Response.Allowed,
+				result.Response.Result)
+		}
+		if "test-uid" != result.Response.UID {
+			t.Errorf("%s: expected uid test-uid, got %q", test.name, result.Response.UID)
+		}
+		if !test.allowed && (nil == result.Response.Result || http.StatusUnprocessableEntity != result.Response.Result.Code) {
+			t.Errorf("%s: expected status 422, got %#v", test.name, result.Response.Result)
+		}
+	}
+}
+
+func TestMutatingWebhook(t *testing.T) {
+	server := httptest.NewServer(NewServeMux())
+	defer server.Close()
+
+	metadata := `{"name": "demo", "namespace": "default"}`
+	tests := []struct {
+		name string
+		body string
+		expectedPatch string
+	}{
+		{"complete spec", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, validSpec), ""), ""},
+		{"partial spec", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, partialSpec), ""),
+			`[{"op":"add","path":"/spec/minReplicas","value":1},{"op":"add","path":"/spec/mode","value":"Auto"},` +
+			`{"op":"add","path":"/spec/targetUtilizationPercentage","value":80},` +
+			`{"op":"add","path":"/spec/utilizationBase","value":"limits"}]`},
+		{"missing spec", review("admission.k8s.io/v1", "CREATE", memHpa(metadata, ""), ""),
+			`[{"op":"add","path":"/spec","value":{"scaleTargetRef":{"kind":"","name":""},"minReplicas":1,` +
+			`"maxReplicas":0,"targetUtilizationPercentage":80,"utilizationBase":"limits","mode":"Auto"}}]`},
+		{"delete", review("admission.k8s.io/v1", "DELETE", "", memHpa(metadata, partialSpec)), ""},
+	}
+	for _, test := range tests {
+		result := postReview(t, server.URL + MutatePath, test.body)
+		if !result.Response.Allowed {
+			t.Errorf("%s: expected allowed, got %#v", test.name, result.Response.Result)
+		}
+		if test.expectedPatch != string(result.Response.Patch) {
+			t.Errorf("%s: expected patch %s, got %s", test.name, test.expectedPatch, result.Response.Patch)
+		}
+		if "" == test.expectedPatch && nil != result.Response.PatchType {
+			t.Errorf("%s: expected no patch type, got %s", test.name, *result.Response.PatchType)
+		}
+		if "" != test.expectedPatch && (nil == result.Response.PatchType || jsonPatchType != *result.Response.PatchType) {
+			t.Errorf("%s: expected patch type %s, got %v", test.name, jsonPatchType, result.Response.PatchType)
+		}
+	}
+}
+
+func TestAdmissionAPIVersion(t *testing.T) {
+	server := httptest.NewServer(NewServeMux())
+	defer server.Close()
+
+	object := memHpa(`{"name": "demo", "namespace": "default"}`, validSpec)
+	for _, apiVersion := range []string{"admission.k8s.io/v1", "admission.k8s.io/v1beta1"} {
+		result := postReview(t, server.URL + ValidatePath, review(apiVersion, "CREATE", object, ""))
+		if apiVersion != result.APIVersion || "AdmissionReview" != result.Kind {
+			t.Errorf("expected %s AdmissionReview, got %s %s", apiVersion, result.APIVersion, result.Kind)
+		}
+	}
+	result := postReview(t, server.URL + ValidatePath, review("", "CREATE", object, ""))
+	if admissionAPIVersion != result.APIVersion {
+		t.Errorf("expected %s for review without apiVersion, got %s", admissionAPIVersion, result.APIVersion)
+	}
+}
+
+func TestInvalidReview(t *testing.T) {
+	server := httptest.NewServer(NewServeMux())
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		method string
+		contentType string
+		body string
+		expectedStatus int
+	}{
+		{"get", "GET", "application/json", "", http.StatusMethodNotAllowed},
+		{"yaml", "POST", "application/yaml", "{}", http.StatusUnsupportedMediaType},
+		{"malformed", "POST", "application/json", "{", http.StatusBadRequest},
+		{"without request", "POST", "application/json", `{"kind": "AdmissionReview"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, server.URL + ValidatePath, bytes.NewBufferString(test.body))
+		if nil != err {
+			t.Fatalf("%s: failed to create request: %v", test.name, err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Fatalf("%s: failed to send request: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if test.expectedStatus != resp.StatusCode {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expectedStatus, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"encoding/json"
+)
+
+// Subset of admission.k8s.io/v1 AdmissionReview, see "Vendored client-go" in README.md
+type AdmissionReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind string `json:"kind"`
+	Request *AdmissionRequest `json:"request,omitempty"`
+	Response *AdmissionResponse `json:"response,omitempty"`
+}
+
+type AdmissionRequest struct {
+	UID string `json:"uid"`
+	Kind GroupVersionKind `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name string `json:"name,omitempty"`
+	// CREATE, UPDATE, DELETE or CONNECT
+	Operation string `json:"operation"`
+	// The object to admit, nil for DELETE
+	Object json.RawMessage `json:"object,omitempty"`
+	OldObject json.RawMessage `json:"oldObject,omitempty"`
+	DryRun *bool `json:"dryRun,omitempty"`
+}
+
+type GroupVersionKind struct {
+	Group string `json:"group"`
+	Version string `json:"version"`
+	Kind string `json:"kind"`
+}
+
+type AdmissionResponse struct {
+	// UID of the request
+	UID string `json:"uid"`
+	Allowed bool `json:"allowed"`
+	// Why the request is denied
+	Result *Status `json:"status,omitempty"`
+	// JSON patch to mutate the object, only used by mutating webhooks
+	Patch []byte `json:"patch,omitempty"`
+	PatchType *string `json:"patchType,omitempty"`
+}
+
+type Status struct {
+	Code int32 `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Operation of RFC 6902 JSON patch
+type PatchOperation struct {
+	Op string `json:"op"`
+	Path string `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}